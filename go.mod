@@ -1,10 +1,11 @@
 module github.com/ONSdigital/dp-filter
 
-go 1.13
+go 1.16
 
 require (
 	github.com/ONSdigital/log.go v1.0.0
 	github.com/johnnadratowski/golang-neo4j-bolt-driver v0.0.0-20200323142034-807201386efa
 	github.com/mattn/go-colorable v0.1.6 // indirect
+	github.com/neo4j/neo4j-go-driver/v4 v4.4.7
 	github.com/smartystreets/goconvey v1.6.4
 )
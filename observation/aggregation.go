@@ -0,0 +1,192 @@
+package observation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAggregation is returned if an aggregation has an unsupported function, does not name each of
+// its group by dimensions once, or is sorted on a dimension it does not group by.
+var ErrInvalidAggregation = errors.New("the aggregation must have a supported function and only sort on unique, named group by dimensions")
+
+// ErrAggregationNotSupported is returned by queries that cannot aggregate observations.
+var ErrAggregationNotSupported = errors.New("aggregations are not supported by this query")
+
+// Functions that can aggregate the observations of a filter.
+const (
+	AggregateSum   = "sum"
+	AggregateMean  = "mean"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateCount = "count"
+)
+
+// aggregateFunctions maps the supported aggregate functions to their Cypher functions.
+var aggregateFunctions = map[string]string{
+	AggregateSum:   "sum",
+	AggregateMean:  "avg",
+	AggregateMin:   "min",
+	AggregateMax:   "max",
+	AggregateCount: "count",
+}
+
+// Aggregation combines the observations of a filter that have the same options for the group by
+// dimensions, e.g. to total the observations of all of the selected ages for each sex. The observations
+// of the other dimensions are combined using the aggregate function. Observations that are not numbers are
+// ignored.
+type Aggregation struct {
+	GroupBy  []string `json:"group_by,omitempty"`
+	Function string   `json:"function"`
+}
+
+// Validate checks that the aggregation, and the sort dimensions of its filter, are well formed.
+func (aggregation *Aggregation) Validate(sort []*SortDimension) error {
+	if _, ok := aggregateFunctions[strings.ToLower(aggregation.Function)]; !ok {
+		return ErrInvalidAggregation
+	}
+
+	grouped := make(map[string]bool, len(aggregation.GroupBy))
+	for _, name := range aggregation.GroupBy {
+		if name == "" || grouped[strings.ToLower(name)] {
+			return ErrInvalidAggregation
+		}
+		grouped[strings.ToLower(name)] = true
+	}
+
+	for _, dimension := range sort {
+		if dimension != nil && !grouped[strings.ToLower(dimension.Name)] {
+			return ErrInvalidAggregation
+		}
+	}
+
+	return nil
+}
+
+// RewriteHeader returns the header of the aggregated rows of an instance with the given header row: a
+// V4_0 observation column followed by the code list and label columns of each group by dimension.
+func (aggregation *Aggregation) RewriteHeader(row string) (string, error) {
+	header, err := ParseHeader(row)
+	if err != nil {
+		return "", err
+	}
+
+	columns := []string{v4Prefix + "0"}
+	for _, name := range aggregation.GroupBy {
+		dimension := header.Dimension(name)
+		if dimension == nil {
+			return "", ErrUnknownDimension
+		}
+		columns = append(columns, header.Columns[dimension.CodeListColumn], header.Columns[dimension.LabelColumn])
+	}
+
+	rewritten, err := formatCSVRow(columns)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(rewritten, "\n"), nil
+}
+
+// FormatAggregatedRow returns the CSV row, without a trailing new line, for the values returned by an
+// aggregation query: the aggregated observation followed by the code and label of each group by
+// dimension. An aggregate of no numeric observations is an empty observation.
+func FormatAggregatedRow(values []interface{}) (string, error) {
+	if len(values) < 1 {
+		return "", ErrNoDataReturned
+	}
+
+	fields := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			fields[i] = v
+		case int64:
+			fields[i] = strconv.FormatInt(v, 10)
+		case float64:
+			fields[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return "", ErrUnrecognisedType
+		}
+	}
+
+	row, err := formatCSVRow(fields)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(row, "\n"), nil
+}
+
+// createAggregationQuery returns the query aggregating the observations of the filter. The value of each
+// observation is the first field of its row.
+func createAggregationQuery(filter *Filter) string {
+	aggregation := filter.Aggregation
+
+	matches, where := createFilterClauses(filter)
+	matched := filteredDimensions(filter)
+
+	// graph labels are lower case, and the group by dimensions are validated ignoring case
+	var groups []string
+	for _, name := range aggregation.GroupBy {
+		name = strings.ToLower(name)
+		if !matched[name] {
+			matches = append(matches, createDimensionMatch(filter.InstanceID, name))
+			matched[name] = true
+		}
+		groups = append(groups, fmt.Sprintf("`%s`", name))
+	}
+
+	var query string
+	if len(matches) == 0 {
+		query = fmt.Sprintf("MATCH (o:`_%s_observation`)", filter.InstanceID)
+	} else {
+		query = createMatchQuery(matches, where)
+	}
+
+	query += " WITH " + strings.Join(append(groups, "toFloat(split(o.value, ',')[0]) AS value"), ", ")
+
+	returns := []string{fmt.Sprintf("%s(value) AS observation", aggregateFunctions[strings.ToLower(aggregation.Function)])}
+	for i, group := range groups {
+		returns = append(returns, fmt.Sprintf("%s.value AS code_%d, %s.label AS label_%d", group, i, group, i))
+	}
+	query += " RETURN " + strings.Join(returns, ", ")
+
+	if len(groups) > 0 {
+		query += createAggregationOrderBy(aggregation, filter.Sort)
+	}
+
+	return query
+}
+
+// createAggregationOrderBy returns an ORDER BY clause for the aggregated rows, ordered by the given sort
+// dimensions followed by the remaining group by dimensions, so that the order of the rows is deterministic.
+func createAggregationOrderBy(aggregation *Aggregation, sort []*SortDimension) string {
+	index := make(map[string]int, len(aggregation.GroupBy))
+	for i, name := range aggregation.GroupBy {
+		index[strings.ToLower(name)] = i
+	}
+
+	var keys []string
+	sorted := make(map[int]bool)
+
+	for _, dimension := range sort {
+		i := index[strings.ToLower(dimension.Name)]
+		key := fmt.Sprintf("code_%d", i)
+		if dimension.Descending {
+			key += " DESC"
+		}
+		keys = append(keys, key)
+		sorted[i] = true
+	}
+
+	for i := range aggregation.GroupBy {
+		if !sorted[i] {
+			keys = append(keys, fmt.Sprintf("code_%d", i))
+		}
+	}
+
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
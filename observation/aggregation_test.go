@@ -0,0 +1,207 @@
+package observation_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore_GetQueryAggregation(t *testing.T) {
+
+	Convey("Given a store", t, func() {
+
+		store := observation.NewStore(&observationtest.DBPoolMock{})
+
+		Convey("When the query is created for a filter summing over a filtered dimension", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"29", "30"}},
+				},
+				Aggregation: &observation.Aggregation{GroupBy: []string{"sex"}, Function: "Sum"},
+			}
+
+			query, err := store.GetQuery(testContext, filter, nil)
+
+			Convey("The observation values are summed for each option of the group by dimension", func() {
+				So(err, ShouldBeNil)
+				So(query.Statement, ShouldEqual, "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) "+
+					"WHERE (`age`.value='29' OR `age`.value='30') "+
+					"WITH `sex`, toFloat(split(o.value, ',')[0]) AS value "+
+					"RETURN sum(value) AS observation, `sex`.value AS code_0, `sex`.label AS label_0 "+
+					"ORDER BY code_0")
+			})
+		})
+
+		Convey("When the query is created for an aggregation grouped by a dimension named in a different case", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "sex", Options: []string{"male"}},
+				},
+				Aggregation: &observation.Aggregation{GroupBy: []string{"Sex"}, Function: observation.AggregateSum},
+			}
+
+			query, err := store.GetQuery(testContext, filter, nil)
+
+			Convey("The lower case graph label is grouped on, reusing the filtered dimension", func() {
+				So(err, ShouldBeNil)
+				So(query.Statement, ShouldStartWith, "MATCH (o)-[:isValueOf]->(`sex`:`_888_sex`) WHERE (`sex`.value='male') WITH `sex`, ")
+				So(query.Statement, ShouldNotContainSubstring, "Sex")
+			})
+		})
+
+		Convey("When the query is created for a filter sorted on one of its group by dimensions", func() {
+
+			filter := &observation.Filter{
+				InstanceID:  "888",
+				Sort:        []*observation.SortDimension{{Name: "sex", Descending: true}},
+				Aggregation: &observation.Aggregation{GroupBy: []string{"age", "sex"}, Function: observation.AggregateMean},
+			}
+
+			query, err := store.GetQuery(testContext, filter, nil)
+
+			Convey("The aggregated rows are ordered by the sort dimension and then the other group by dimensions", func() {
+				So(err, ShouldBeNil)
+				So(query.Statement, ShouldStartWith, "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) WITH `age`, `sex`, ")
+				So(query.Statement, ShouldContainSubstring, "RETURN avg(value) AS observation")
+				So(query.Statement, ShouldEndWith, "ORDER BY code_1 DESC, code_0")
+			})
+		})
+
+		Convey("When the query is created for an aggregation of the entire dataset", func() {
+
+			filter := &observation.Filter{
+				InstanceID:  "888",
+				Aggregation: &observation.Aggregation{Function: observation.AggregateCount},
+			}
+
+			query, err := store.GetQuery(testContext, filter, nil)
+
+			Convey("A single aggregate of all the observations is queried", func() {
+				So(err, ShouldBeNil)
+				So(query.Statement, ShouldEqual, "MATCH (o:`_888_observation`) WITH toFloat(split(o.value, ',')[0]) AS value RETURN count(value) AS observation")
+			})
+		})
+
+		Convey("When the query is created for invalid aggregations", func() {
+
+			unsupported := &observation.Filter{Aggregation: &observation.Aggregation{Function: "median"}}
+			duplicated := &observation.Filter{Aggregation: &observation.Aggregation{GroupBy: []string{"sex", "Sex"}, Function: "sum"}}
+			ungrouped := &observation.Filter{
+				Sort:        []*observation.SortDimension{{Name: "age"}},
+				Aggregation: &observation.Aggregation{GroupBy: []string{"sex"}, Function: "sum"},
+			}
+
+			Convey("ErrInvalidAggregation is returned", func() {
+				for _, filter := range []*observation.Filter{unsupported, duplicated, ungrouped} {
+					_, err := store.GetQuery(testContext, filter, nil)
+					So(err, ShouldEqual, observation.ErrInvalidAggregation)
+				}
+			})
+		})
+	})
+}
+
+func TestStore_GetCSVRowsAggregation(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection returning aggregated rows", t, func() {
+
+		rows := [][]interface{}{{59.5, "female", "Female"}, {int64(3), "male", "Male"}, {nil, "other", "Other, not stated"}}
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				if len(rows) == 0 {
+					return nil, nil, io.EOF
+				}
+				row := rows[0]
+				rows = rows[1:]
+				return row, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{"V4_1,data_marking,age_codelist,age,sex_codelist,sex"}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return mockBoltRows, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		store := observation.NewStore(&observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		})
+
+		filter := &observation.Filter{
+			InstanceID:  "888",
+			Aggregation: &observation.Aggregation{GroupBy: []string{"Sex"}, Function: observation.AggregateSum},
+		}
+
+		Convey("When the rows are read", func() {
+
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+			So(err, ShouldBeNil)
+			actual, err := readAllRows(reader)
+
+			Convey("The header is rewritten to the group by dimensions, followed by the aggregated rows", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_0,sex_codelist,sex\n",
+					"59.5,female,Female\n",
+					"3,male,Male\n",
+					",other,\"Other, not stated\"\n",
+				})
+			})
+		})
+
+		Convey("When the rows are read for an aggregation grouped by an unknown dimension", func() {
+
+			filter.Aggregation.GroupBy = []string{"geography"}
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("ErrUnknownDimension is returned and the connection is released", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestFilter_FingerprintAggregation(t *testing.T) {
+
+	Convey("Given a filter with an aggregation", t, func() {
+
+		filter := observation.Filter{
+			InstanceID:  "888",
+			Aggregation: &observation.Aggregation{GroupBy: []string{"sex"}, Function: "SUM"},
+		}
+
+		Convey("Its fingerprint differs from the unaggregated filter, but not from the same aggregation in a different case", func() {
+			unaggregated := observation.Filter{InstanceID: "888"}
+			lower := observation.Filter{
+				InstanceID:  "888",
+				Aggregation: &observation.Aggregation{GroupBy: []string{"sex"}, Function: "sum"},
+			}
+
+			So(filter.Fingerprint(), ShouldNotEqual, unaggregated.Fingerprint())
+			So(filter.Fingerprint(), ShouldEqual, lower.Fingerprint())
+		})
+	})
+}
@@ -0,0 +1,197 @@
+// Package cache provides a cache of the CSV rows returned for a filter, keyed on the filter fingerprint, so
+// that popular filters do not need to be queried from the graph database each time they are requested.
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/ONSdigital/dp-filter/observation"
+)
+
+// ErrInvalidInstanceID is returned by backends if an instance ID cannot be safely used as a cache location.
+var ErrInvalidInstanceID = errors.New("invalid instance id for cache")
+
+// ErrEntryTooLarge is returned by backend writers if the rows are too large to be cached.
+var ErrEntryTooLarge = errors.New("the rows are too large to cache")
+
+// Check that the cache conforms to the CSVRowGetter interface.
+var _ observation.CSVRowGetter = (*Cache)(nil)
+
+// Backend provides storage for completed row streams.
+type Backend interface {
+	// Get returns a reader for the rows stored under the given key, or false if there are none.
+	Get(key string) (observation.CSVRowReader, bool, error)
+	// Put returns a writer to store rows under the given key for the given instance.
+	Put(key, instanceID string) (Writer, error)
+	// Invalidate removes all rows stored for the given instance.
+	Invalidate(instanceID string) error
+}
+
+// Writer stores a stream of rows. Rows are only visible to Get once they have been committed.
+type Writer interface {
+	WriteRow(row string) error
+	Commit() error
+	Abort() error
+}
+
+// Cache wraps a CSVRowGetter, storing the rows it returns in a backend and returning them from the backend
+// when the same filter is requested again.
+type Cache struct {
+	getter  observation.CSVRowGetter
+	backend Backend
+	logger  observation.Logger
+}
+
+// Option configures optional behaviour of a Cache.
+type Option func(cache *Cache)
+
+// WithLogger returns an option sending the log events of the cache to the given logger. Unless it is
+// used, failures of the backend are not logged.
+func WithLogger(logger observation.Logger) Option {
+	return func(cache *Cache) {
+		cache.logger = logger
+	}
+}
+
+// New returns a new cache of the rows returned by the given getter, stored in the given backend.
+func New(getter observation.CSVRowGetter, backend Backend, opts ...Option) *Cache {
+	cache := &Cache{
+		getter:  getter,
+		backend: backend,
+	}
+
+	for _, opt := range opts {
+		opt(cache)
+	}
+
+	return cache
+}
+
+// Key returns the key the rows for the given filter and limit are cached under.
+func Key(filter *observation.Filter, limit *int) string {
+	key := filter.Fingerprint()
+	if limit != nil {
+		key += "-" + strconv.Itoa(*limit)
+	}
+
+	return key
+}
+
+// GetCSVRows returns a reader for the cached rows of the filter if there are any. Otherwise the rows are
+// read from the wrapped getter and stored in the backend once they have all been read successfully, unless
+// the instance is invalidated after they are requested.
+// Failures of the backend are logged and the rows are read from the wrapped getter instead.
+func (cache *Cache) GetCSVRows(ctx context.Context, filter *observation.Filter, limit *int) (observation.CSVRowReader, error) {
+	key := Key(filter, limit)
+	logData := map[string]interface{}{
+		"filterID":   filter.FilterID,
+		"instanceID": filter.InstanceID,
+		"key":        key,
+	}
+
+	cached, ok, err := cache.backend.Get(key)
+	if err != nil {
+		cache.log(ctx, observation.LevelWarn, "failed to read cached rows", logData, err)
+	} else if ok {
+		cache.log(ctx, observation.LevelInfo, "returning cached rows", logData, nil)
+		return cached, nil
+	}
+
+	// the writer is reserved before the rows are read, so that an invalidation of the instance while they
+	// are being read stops them being committed
+	writer, err := cache.backend.Put(key, filter.InstanceID)
+	if err != nil {
+		cache.log(ctx, observation.LevelWarn, "failed to start caching rows", logData, err)
+		return cache.getter.GetCSVRows(ctx, filter, limit)
+	}
+
+	rowReader, err := cache.getter.GetCSVRows(ctx, filter, limit)
+	if err != nil {
+		if abortErr := writer.Abort(); abortErr != nil {
+			cache.log(ctx, observation.LevelWarn, "failed to abort caching rows", logData, abortErr)
+		}
+		return nil, err
+	}
+
+	return &cachingRowReader{
+		cache:   cache,
+		ctx:     ctx,
+		reader:  rowReader,
+		writer:  writer,
+		logData: logData,
+	}, nil
+}
+
+// Invalidate removes all cached rows for the given instance, e.g. when a new version has been published.
+func (cache *Cache) Invalidate(instanceID string) error {
+	return cache.backend.Invalidate(instanceID)
+}
+
+// log sends an event to the logger of the cache, if it has one.
+func (cache *Cache) log(ctx context.Context, level observation.Level, event string, data map[string]interface{}, err error) {
+	if cache.logger != nil {
+		cache.logger.Log(ctx, level, event, data, err)
+	}
+}
+
+// cachingRowReader writes each row read to a cache writer, committing the rows once io.EOF is reached.
+type cachingRowReader struct {
+	cache   *Cache
+	ctx     context.Context
+	reader  observation.CSVRowReader
+	writer  Writer // set to nil once the rows have been committed or aborted
+	logData map[string]interface{}
+}
+
+// Read the next row from the underlying reader, writing it to the cache.
+func (reader *cachingRowReader) Read() (string, error) {
+	row, err := reader.reader.Read()
+
+	if reader.writer != nil {
+		if len(row) > 0 {
+			if writeErr := reader.writer.WriteRow(row); writeErr != nil {
+				reader.cache.log(reader.ctx, observation.LevelWarn, "failed to cache row", reader.logData, writeErr)
+				reader.abort()
+			}
+		}
+
+		if err == io.EOF {
+			reader.commit()
+		} else if err != nil {
+			reader.abort()
+		}
+	}
+
+	return row, err
+}
+
+// Close the underlying reader. Rows that have not been read to the end are not cached.
+func (reader *cachingRowReader) Close() error {
+	reader.abort()
+	return reader.reader.Close()
+}
+
+func (reader *cachingRowReader) commit() {
+	if reader.writer == nil {
+		return
+	}
+
+	if err := reader.writer.Commit(); err != nil {
+		reader.cache.log(reader.ctx, observation.LevelWarn, "failed to commit cached rows", reader.logData, err)
+	}
+	reader.writer = nil
+}
+
+func (reader *cachingRowReader) abort() {
+	if reader.writer == nil {
+		return
+	}
+
+	if err := reader.writer.Abort(); err != nil {
+		reader.cache.log(reader.ctx, observation.LevelWarn, "failed to abort caching rows", reader.logData, err)
+	}
+	reader.writer = nil
+}
@@ -0,0 +1,206 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/cache"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var testContext = context.Background()
+
+var testRows = []string{"V4_0,time_codelist,time\n", "1,2017,2017\n", "2,2018,2018\n"}
+
+func newMockRowReader(rows ...string) *observationtest.CSVRowReaderMock {
+	return &observationtest.CSVRowReaderMock{
+		ReadFunc: func() (string, error) {
+			if len(rows) == 0 {
+				return "", io.EOF
+			}
+			row := rows[0]
+			rows = rows[1:]
+			return row, nil
+		},
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+func readAllRows(reader observation.CSVRowReader) ([]string, error) {
+	var rows []string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestCache_GetCSVRows(t *testing.T) {
+
+	Convey("Given a cache with an in memory backend in front of a mock store", t, func() {
+
+		mockStore := &observationtest.CSVRowGetterMock{
+			GetCSVRowsFunc: func(ctx context.Context, filter *observation.Filter, limit *int) (observation.CSVRowReader, error) {
+				return newMockRowReader(testRows...), nil
+			},
+		}
+
+		backend := cache.NewMemoryBackend(10, 0)
+		c := cache.New(mockStore, backend)
+
+		filter := &observation.Filter{
+			InstanceID: "888",
+			DimensionFilters: []*observation.DimensionFilter{
+				{Name: "time", Options: []string{"2017", "2018"}},
+			},
+		}
+
+		Convey("When the rows for a filter are read to the end twice", func() {
+
+			reader1, err1 := c.GetCSVRows(testContext, filter, nil)
+			rows1, readErr1 := readAllRows(reader1)
+			reader1.Close()
+
+			equivalent := &observation.Filter{
+				FilterID:   "another",
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "time", Options: []string{"2018", "2017"}},
+				},
+			}
+
+			reader2, err2 := c.GetCSVRows(testContext, equivalent, nil)
+			rows2, readErr2 := readAllRows(reader2)
+
+			Convey("The store is only queried once and the same rows are returned each time", func() {
+				So(err1, ShouldBeNil)
+				So(readErr1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(readErr2, ShouldBeNil)
+				So(rows1, ShouldResemble, testRows)
+				So(rows2, ShouldResemble, testRows)
+				So(len(mockStore.GetCSVRowsCalls()), ShouldEqual, 1)
+			})
+
+			Convey("And the instance is invalidated, the store is queried again", func() {
+
+				So(c.Invalidate("888"), ShouldBeNil)
+
+				_, err := c.GetCSVRows(testContext, filter, nil)
+
+				So(err, ShouldBeNil)
+				So(backend.Len(), ShouldEqual, 0)
+				So(len(mockStore.GetCSVRowsCalls()), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the rows for a filter are closed before they are read to the end", func() {
+
+			reader, err := c.GetCSVRows(testContext, filter, nil)
+			reader.Read()
+			reader.Close()
+
+			Convey("The rows are not cached", func() {
+				So(err, ShouldBeNil)
+				So(backend.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the rows for the same filter are requested with a different limit", func() {
+
+			limit := 1
+			reader, _ := c.GetCSVRows(testContext, filter, nil)
+			readAllRows(reader)
+			c.GetCSVRows(testContext, filter, &limit)
+
+			Convey("The store is queried for each limit", func() {
+				So(len(mockStore.GetCSVRowsCalls()), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a mock store whose instance is invalidated while its rows are being queried", t, func() {
+
+		dir, err := ioutil.TempDir("", "cache")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		backends := map[string]cache.Backend{
+			"memory": cache.NewMemoryBackend(10, 0),
+			"file":   cache.NewFileBackend(dir),
+		}
+
+		for name, backend := range backends {
+			var c *cache.Cache
+			mockStore := &observationtest.CSVRowGetterMock{
+				GetCSVRowsFunc: func(ctx context.Context, filter *observation.Filter, limit *int) (observation.CSVRowReader, error) {
+					So(c.Invalidate(filter.InstanceID), ShouldBeNil)
+					return newMockRowReader(testRows...), nil
+				},
+			}
+			c = cache.New(mockStore, backend)
+			filter := &observation.Filter{InstanceID: "888"}
+
+			Convey("When the rows are read to the end through a cache with a "+name+" backend", func() {
+
+				reader, err := c.GetCSVRows(testContext, filter, nil)
+				So(err, ShouldBeNil)
+				rows, err := readAllRows(reader)
+				So(err, ShouldBeNil)
+				So(rows, ShouldResemble, testRows)
+
+				Convey("The rows read before the invalidation are not cached", func() {
+					_, ok, err := backend.Get(cache.Key(filter, nil))
+					So(err, ShouldBeNil)
+					So(ok, ShouldBeFalse)
+				})
+			})
+		}
+	})
+
+	Convey("Given a cache in front of a mock store returning an error while reading rows", t, func() {
+
+		expectedErr := errors.New("broken")
+
+		mockStore := &observationtest.CSVRowGetterMock{
+			GetCSVRowsFunc: func(ctx context.Context, filter *observation.Filter, limit *int) (observation.CSVRowReader, error) {
+				return &observationtest.CSVRowReaderMock{
+					ReadFunc: func() (string, error) {
+						return "", expectedErr
+					},
+					CloseFunc: func() error {
+						return nil
+					},
+				}, nil
+			},
+		}
+
+		backend := cache.NewMemoryBackend(10, 0)
+		c := cache.New(mockStore, backend)
+
+		Convey("When the rows for a filter are read", func() {
+
+			reader, err := c.GetCSVRows(testContext, &observation.Filter{InstanceID: "888"}, nil)
+			_, readErr := reader.Read()
+
+			Convey("The error is returned and the rows are not cached", func() {
+				So(err, ShouldBeNil)
+				So(readErr, ShouldEqual, expectedErr)
+				So(backend.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ONSdigital/dp-filter/observation"
+)
+
+// Check that the file backend conforms to the Backend interface.
+var _ Backend = (*FileBackend)(nil)
+
+const fileExtension = ".rows"
+
+// FileBackend stores rows in files beneath a directory, in a sub directory for each instance so that all
+// the rows for an instance can be removed at once.
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend returns a new backend storing rows beneath the given directory.
+func NewFileBackend(dir string) *FileBackend {
+	return &FileBackend{
+		dir: dir,
+	}
+}
+
+// Get returns a reader for the rows stored under the given key, or false if there are none.
+func (backend *FileBackend) Get(key string) (observation.CSVRowReader, bool, error) {
+	if !validPathElement(key) {
+		return nil, false, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(backend.dir, "*", key+fileExtension))
+	if err != nil || len(paths) == 0 {
+		return nil, false, err
+	}
+
+	file, err := os.Open(paths[0])
+	if os.IsNotExist(err) {
+		// the instance was invalidated after the files were listed
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return &fileRowReader{
+		file:   file,
+		reader: bufio.NewReader(file),
+	}, true, nil
+}
+
+// Put returns a writer to store rows under the given key for the given instance. The rows are written to a
+// temporary file which is renamed once committed.
+func (backend *FileBackend) Put(key, instanceID string) (Writer, error) {
+	if !validPathElement(key) || !validPathElement(instanceID) {
+		return nil, ErrInvalidInstanceID
+	}
+
+	instanceDir := filepath.Join(backend.dir, instanceID)
+	if err := os.MkdirAll(instanceDir, 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(instanceDir, key+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileWriter{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		path:   filepath.Join(instanceDir, key+fileExtension),
+	}, nil
+}
+
+// Invalidate removes all rows stored for the given instance. Writers for the instance that have not yet
+// been committed will fail to commit.
+func (backend *FileBackend) Invalidate(instanceID string) error {
+	if !validPathElement(instanceID) {
+		return ErrInvalidInstanceID
+	}
+
+	return os.RemoveAll(filepath.Join(backend.dir, instanceID))
+}
+
+// validPathElement returns true if the value can be used as a single file or directory name.
+func validPathElement(value string) bool {
+	return value != "" && value != "." && value != ".." && !strings.ContainsAny(value, `/\*?[`)
+}
+
+// fileWriter writes each row to a file prefixed with its length, so rows containing new lines are preserved.
+type fileWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	path   string
+	buf    [binary.MaxVarintLen64]byte
+}
+
+func (writer *fileWriter) WriteRow(row string) error {
+	n := binary.PutUvarint(writer.buf[:], uint64(len(row)))
+	if _, err := writer.writer.Write(writer.buf[:n]); err != nil {
+		return err
+	}
+
+	_, err := writer.writer.WriteString(row)
+	return err
+}
+
+func (writer *fileWriter) Commit() error {
+	if err := writer.writer.Flush(); err != nil {
+		writer.Abort()
+		return err
+	}
+
+	if err := writer.file.Close(); err != nil {
+		os.Remove(writer.file.Name())
+		return err
+	}
+
+	return os.Rename(writer.file.Name(), writer.path)
+}
+
+func (writer *fileWriter) Abort() error {
+	writer.file.Close()
+
+	err := os.Remove(writer.file.Name())
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// fileRowReader reads length prefixed rows from a file.
+type fileRowReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+func (reader *fileRowReader) Read() (string, error) {
+	length, err := binary.ReadUvarint(reader.reader)
+	if err != nil {
+		return "", err
+	}
+
+	row := make([]byte, length)
+	if _, err := io.ReadFull(reader.reader, row); err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	return string(row), nil
+}
+
+func (reader *fileRowReader) Close() error {
+	return reader.file.Close()
+}
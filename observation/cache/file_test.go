@@ -0,0 +1,80 @@
+package cache_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileBackend(t *testing.T) {
+
+	Convey("Given a file backend in a temporary directory", t, func() {
+
+		dir, err := ioutil.TempDir("", "dp-filter-cache")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		backend := cache.NewFileBackend(dir)
+
+		Convey("When rows containing new lines are stored", func() {
+
+			rows := append([]string{"1,\"multi\nline\",x\n"}, testRows...)
+			So(putRows(backend, "a", "888", rows...), ShouldBeNil)
+
+			Convey("The same rows are read back", func() {
+				reader, ok, err := backend.Get("a")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+
+				actual, err := readAllRows(reader)
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, rows)
+				So(reader.Close(), ShouldBeNil)
+			})
+
+			Convey("And the instance is invalidated, the rows are removed", func() {
+				So(backend.Invalidate("888"), ShouldBeNil)
+
+				_, ok, err := backend.Get("a")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When rows are written but not committed", func() {
+
+			writer, err := backend.Put("a", "888")
+			So(err, ShouldBeNil)
+			So(writer.WriteRow(testRows[0]), ShouldBeNil)
+
+			Convey("The rows are not visible until committed", func() {
+				_, ok, _ := backend.Get("a")
+				So(ok, ShouldBeFalse)
+
+				So(writer.Commit(), ShouldBeNil)
+				_, ok, _ = backend.Get("a")
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("And the instance is invalidated, the rows cannot be committed", func() {
+				So(backend.Invalidate("888"), ShouldBeNil)
+				So(writer.Commit(), ShouldNotBeNil)
+
+				_, ok, _ := backend.Get("a")
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When rows are stored for an instance ID that is not a valid directory name", func() {
+
+			_, err := backend.Put("a", "../888")
+
+			Convey("The expected error is returned", func() {
+				So(err, ShouldEqual, cache.ErrInvalidInstanceID)
+			})
+		})
+	})
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+
+	"github.com/ONSdigital/dp-filter/observation"
+)
+
+// Check that the memory backend conforms to the Backend interface.
+var _ Backend = (*MemoryBackend)(nil)
+
+// MemoryBackend stores rows in memory, evicting the least recently used entries once the maximum number of
+// entries or bytes has been reached.
+type MemoryBackend struct {
+	maxEntries  int
+	maxBytes    int64
+	mutex       sync.Mutex
+	entries     *list.List // of *memoryEntry, most recently used first
+	keys        map[string]*list.Element
+	bytes       int64
+	generations map[string]int // incremented each time an instance is invalidated
+}
+
+type memoryEntry struct {
+	key        string
+	instanceID string
+	rows       []string
+	bytes      int64
+}
+
+// NewMemoryBackend returns a new in memory backend holding at most maxEntries row streams and maxBytes
+// bytes of rows. A limit of zero or less is unlimited.
+func NewMemoryBackend(maxEntries int, maxBytes int64) *MemoryBackend {
+	return &MemoryBackend{
+		maxEntries:  maxEntries,
+		maxBytes:    maxBytes,
+		entries:     list.New(),
+		keys:        make(map[string]*list.Element),
+		generations: make(map[string]int),
+	}
+}
+
+// Get returns a reader for the rows stored under the given key, or false if there are none.
+func (backend *MemoryBackend) Get(key string) (observation.CSVRowReader, bool, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	element, ok := backend.keys[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	backend.entries.MoveToFront(element)
+
+	return &memoryRowReader{rows: element.Value.(*memoryEntry).rows}, true, nil
+}
+
+// Put returns a writer to store rows under the given key for the given instance.
+func (backend *MemoryBackend) Put(key, instanceID string) (Writer, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	return &memoryWriter{
+		backend:    backend,
+		generation: backend.generations[instanceID],
+		entry: &memoryEntry{
+			key:        key,
+			instanceID: instanceID,
+		},
+	}, nil
+}
+
+// Invalidate removes all rows stored for the given instance.
+func (backend *MemoryBackend) Invalidate(instanceID string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	backend.generations[instanceID]++
+
+	for element := backend.entries.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*memoryEntry).instanceID == instanceID {
+			backend.remove(element)
+		}
+		element = next
+	}
+
+	return nil
+}
+
+// Len returns the number of row streams stored.
+func (backend *MemoryBackend) Len() int {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	return backend.entries.Len()
+}
+
+func (backend *MemoryBackend) add(entry *memoryEntry, generation int) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	// the instance has been invalidated since the rows were read, so they may be out of date
+	if backend.generations[entry.instanceID] != generation {
+		return
+	}
+
+	if backend.maxBytes > 0 && entry.bytes > backend.maxBytes {
+		return
+	}
+
+	if element, ok := backend.keys[entry.key]; ok {
+		backend.remove(element)
+	}
+
+	backend.keys[entry.key] = backend.entries.PushFront(entry)
+	backend.bytes += entry.bytes
+
+	for backend.entries.Len() > 0 &&
+		((backend.maxEntries > 0 && backend.entries.Len() > backend.maxEntries) ||
+			(backend.maxBytes > 0 && backend.bytes > backend.maxBytes)) {
+		backend.remove(backend.entries.Back())
+	}
+}
+
+func (backend *MemoryBackend) remove(element *list.Element) {
+	entry := backend.entries.Remove(element).(*memoryEntry)
+	delete(backend.keys, entry.key)
+	backend.bytes -= entry.bytes
+}
+
+// memoryWriter buffers rows until they are committed to the backend.
+type memoryWriter struct {
+	backend    *MemoryBackend
+	generation int
+	entry      *memoryEntry
+}
+
+func (writer *memoryWriter) WriteRow(row string) error {
+	writer.entry.rows = append(writer.entry.rows, row)
+	writer.entry.bytes += int64(len(row))
+
+	// stop buffering rows that could never be stored
+	if writer.backend.maxBytes > 0 && writer.entry.bytes > writer.backend.maxBytes {
+		return ErrEntryTooLarge
+	}
+
+	return nil
+}
+
+func (writer *memoryWriter) Commit() error {
+	writer.backend.add(writer.entry, writer.generation)
+	return nil
+}
+
+func (writer *memoryWriter) Abort() error {
+	writer.entry.rows = nil
+	return nil
+}
+
+// memoryRowReader reads rows from a slice.
+type memoryRowReader struct {
+	rows []string
+}
+
+func (reader *memoryRowReader) Read() (string, error) {
+	if len(reader.rows) == 0 {
+		return "", io.EOF
+	}
+
+	row := reader.rows[0]
+	reader.rows = reader.rows[1:]
+
+	return row, nil
+}
+
+func (reader *memoryRowReader) Close() error {
+	return nil
+}
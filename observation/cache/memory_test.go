@@ -0,0 +1,83 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func putRows(backend cache.Backend, key, instanceID string, rows ...string) error {
+	writer, err := backend.Put(key, instanceID)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+
+	return writer.Commit()
+}
+
+func TestMemoryBackend(t *testing.T) {
+
+	Convey("Given a memory backend limited to two entries", t, func() {
+
+		backend := cache.NewMemoryBackend(2, 0)
+
+		Convey("When three entries are stored after the first has been read", func() {
+
+			So(putRows(backend, "a", "888", testRows...), ShouldBeNil)
+			So(putRows(backend, "b", "888", testRows...), ShouldBeNil)
+			backend.Get("a")
+			So(putRows(backend, "c", "999", testRows...), ShouldBeNil)
+
+			Convey("The least recently used entry is evicted", func() {
+				_, okA, _ := backend.Get("a")
+				_, okB, _ := backend.Get("b")
+				reader, okC, err := backend.Get("c")
+
+				So(okA, ShouldBeTrue)
+				So(okB, ShouldBeFalse)
+				So(okC, ShouldBeTrue)
+				So(err, ShouldBeNil)
+
+				rows, err := readAllRows(reader)
+				So(err, ShouldBeNil)
+				So(rows, ShouldResemble, testRows)
+			})
+		})
+
+		Convey("When an instance is invalidated while its rows are being written", func() {
+
+			writer, _ := backend.Put("a", "888")
+			writer.WriteRow(testRows[0])
+			So(backend.Invalidate("888"), ShouldBeNil)
+			So(writer.Commit(), ShouldBeNil)
+
+			Convey("The rows are not stored", func() {
+				_, ok, _ := backend.Get("a")
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a memory backend limited to fewer bytes than the rows", t, func() {
+
+		backend := cache.NewMemoryBackend(0, 10)
+
+		Convey("When the rows are stored", func() {
+
+			err := putRows(backend, "a", "888", testRows...)
+
+			Convey("The rows are rejected", func() {
+				So(err, ShouldEqual, cache.ErrEntryTooLarge)
+				So(backend.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
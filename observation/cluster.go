@@ -0,0 +1,100 @@
+package observation
+
+import (
+	"context"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// ReadDBPool is implemented by pools that can route connections for reads, e.g. to the followers and read
+// replicas of a causal cluster rather than to its leader. Stores use it for every call unless WithReadPool
+// is used.
+type ReadDBPool interface {
+	OpenReadPool() (bolt.Conn, error)
+}
+
+type bookmarksKey struct{}
+
+// WithReadPool returns an option routing every call of the store to the given pool, e.g. a pool of
+// connections to the followers and read replicas of a causal cluster.
+func WithReadPool(pool DBPool) Option {
+	return func(store *Store) {
+		store.readPool = pool
+	}
+}
+
+// WithReadTransactions returns an option running every call of the store in an explicit read
+// transaction, which is rolled back once the call has finished with its connection.
+func WithReadTransactions() Option {
+	return func(store *Store) {
+		store.readTx = true
+	}
+}
+
+// ContextWithBookmarks returns a context whose calls only read data once the transactions with the given
+// bookmarks have been applied, e.g. to read the observations of an instance that has just been imported.
+// Calls with bookmarks are always run in an explicit read transaction.
+func ContextWithBookmarks(ctx context.Context, bookmarks ...string) context.Context {
+	return context.WithValue(ctx, bookmarksKey{}, bookmarks)
+}
+
+// BookmarksFromContext returns the bookmarks set on the context by ContextWithBookmarks.
+func BookmarksFromContext(ctx context.Context) []string {
+	bookmarks, _ := ctx.Value(bookmarksKey{}).([]string)
+	return bookmarks
+}
+
+// openRead opens a connection for reads from the read pool of the store.
+func (store *Store) openRead() (bolt.Conn, error) {
+	if store.readPool != nil {
+		return store.readPool.OpenPool()
+	}
+
+	if pool, ok := store.pool.(ReadDBPool); ok {
+		return pool.OpenReadPool()
+	}
+
+	return store.pool.OpenPool()
+}
+
+// beginRead begins a read transaction on the connection if the store uses them or the call has bookmarks.
+// The connection returned rolls back the transaction when it is closed. The connection is closed if the
+// transaction cannot be started.
+func (store *Store) beginRead(ctx context.Context, conn bolt.Conn, filter *Filter) (bolt.Conn, error) {
+	bookmarks := BookmarksFromContext(ctx)
+	if !store.readTx && len(bookmarks) == 0 {
+		return conn, nil
+	}
+
+	// The bolt driver does not support bookmarks, so the transaction is started with a BEGIN statement, which
+	// takes the bookmarks to wait for as parameters.
+	var params map[string]interface{}
+	if len(bookmarks) > 0 {
+		params = map[string]interface{}{
+			"bookmark":  bookmarks[len(bookmarks)-1],
+			"bookmarks": bookmarks,
+		}
+	}
+
+	if _, err := conn.ExecNeo("BEGIN", params); err != nil {
+		conn.Close()
+		return nil, newDriverError(filter, err)
+	}
+
+	return &readTxConn{Conn: conn}, nil
+}
+
+// readTxConn rolls back its read transaction before releasing the connection back into the pool. Nothing
+// is written by the store, so there is nothing to commit.
+type readTxConn struct {
+	bolt.Conn
+}
+
+func (conn *readTxConn) Close() error {
+	_, err := conn.Conn.ExecNeo("ROLLBACK", nil)
+	if closeErr := conn.Conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,148 @@
+package observation_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// routingPool is a DBPool that can route connections for reads.
+type routingPool struct {
+	*observationtest.DBPoolMock
+	readConn  bolt.Conn
+	readCalls int
+}
+
+func (pool *routingPool) OpenReadPool() (bolt.Conn, error) {
+	pool.readCalls++
+	return pool.readConn, nil
+}
+
+func newHeaderConnection() *observationtest.ConnMock {
+	return &observationtest.ConnMock{
+		QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+			return [][]interface{}{{expectedHeader}}, nil, nil, nil
+		},
+		ExecNeoFunc: func(query string, params map[string]interface{}) (bolt.Result, error) {
+			return nil, nil
+		},
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+func TestStore_ReadRouting(t *testing.T) {
+
+	Convey("Given a pool and a separate read pool", t, func() {
+
+		writeConn := newHeaderConnection()
+		readConn := newHeaderConnection()
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return writeConn, nil
+			},
+		}
+		mockedReadPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return readConn, nil
+			},
+		}
+
+		Convey("When GetHeader is called on a store using the read pool", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithReadPool(mockedReadPool))
+			header, err := store.GetHeader(testContext, "888")
+
+			Convey("The header is read from the read pool", func() {
+				So(err, ShouldBeNil)
+				So(header, ShouldEqual, expectedHeader)
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 0)
+				So(len(readConn.QueryNeoAllCalls()), ShouldEqual, 1)
+				So(len(readConn.CloseCalls()), ShouldEqual, 1)
+			})
+
+			Convey("No transaction is started", func() {
+				So(len(readConn.ExecNeoCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When GetHeader is called on a store whose pool can route reads", func() {
+
+			pool := &routingPool{DBPoolMock: mockedPool, readConn: readConn}
+			store := observation.NewStore(pool)
+			_, err := store.GetHeader(testContext, "888")
+
+			Convey("The connection is opened for reads", func() {
+				So(err, ShouldBeNil)
+				So(pool.readCalls, ShouldEqual, 1)
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestStore_ReadTransactions(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection", t, func() {
+
+		conn := newHeaderConnection()
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return conn, nil
+			},
+		}
+
+		Convey("When GetHeader is called on a store using read transactions", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithReadTransactions())
+			_, err := store.GetHeader(testContext, "888")
+
+			Convey("The query is run in a transaction that is rolled back before the connection is closed", func() {
+				So(err, ShouldBeNil)
+				So(len(conn.ExecNeoCalls()), ShouldEqual, 2)
+				So(conn.ExecNeoCalls()[0].Query, ShouldEqual, "BEGIN")
+				So(conn.ExecNeoCalls()[0].Params, ShouldBeNil)
+				So(conn.ExecNeoCalls()[1].Query, ShouldEqual, "ROLLBACK")
+				So(len(conn.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetHeader is called with bookmarks", func() {
+
+			ctx := observation.ContextWithBookmarks(testContext, "bookmark:1", "bookmark:2")
+			store := observation.NewStore(mockedPool)
+			_, err := store.GetHeader(ctx, "888")
+
+			Convey("The transaction is started with the bookmarks", func() {
+				So(err, ShouldBeNil)
+				So(conn.ExecNeoCalls()[0].Query, ShouldEqual, "BEGIN")
+				So(conn.ExecNeoCalls()[0].Params, ShouldResemble, map[string]interface{}{
+					"bookmark":  "bookmark:2",
+					"bookmarks": []string{"bookmark:1", "bookmark:2"},
+				})
+			})
+		})
+
+		Convey("When the transaction cannot be started", func() {
+
+			conn.ExecNeoFunc = func(query string, params map[string]interface{}) (bolt.Result, error) {
+				return nil, errors.New("broken")
+			}
+			store := observation.NewStore(mockedPool, observation.WithReadTransactions())
+			_, err := store.GetHeader(testContext, "888")
+
+			Convey("A driver error is returned and the connection is closed", func() {
+				So(errors.Is(err, observation.ErrDriver), ShouldBeTrue)
+				So(len(conn.QueryNeoAllCalls()), ShouldEqual, 0)
+				So(len(conn.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
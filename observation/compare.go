@@ -0,0 +1,385 @@
+package observation
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrIncompatibleInstances is returned if instances are compared that do not have the same dimensions.
+var ErrIncompatibleInstances = errors.New("the instances do not have the same dimensions")
+
+// Statuses of the rows of a comparison.
+const (
+	ComparisonAdded     = "added"     // the observation is only in the new instance
+	ComparisonRemoved   = "removed"   // the observation is only in the old instance
+	ComparisonChanged   = "changed"   // the observation is in both instances with different values
+	ComparisonUnchanged = "unchanged" // the observation is in both instances with the same value
+)
+
+// Columns following the dimension columns of a comparison.
+var comparisonColumns = []string{"old_observation", "new_observation", "difference", "status"}
+
+// Check that the comparison row reader conforms to the CSVRowReader interface.
+var _ CSVRowReader = (*ComparisonRowReader)(nil)
+
+// GetComparison returns a reader of the observations selected by the filter in two instances, e.g. two
+// versions of a dataset, keyed on their dimension options. The first row is a header naming the code list
+// and label columns of each dimension, followed by the old_observation, new_observation, difference and
+// status columns. The difference is only set if both observations are numbers. The filter must not have
+// a projection. If it has an aggregation the aggregated rows are compared. Its sort is replaced by the
+// dimensions of the instances so that their rows can be matched as they are read.
+func (store *Store) GetComparison(ctx context.Context, filter *Filter, oldInstanceID, newInstanceID string) (CSVRowReader, error) {
+	if filter.Projection != nil {
+		return nil, ErrInvalidProjection
+	}
+
+	oldHeader, err := store.getParsedHeaderOf(ctx, filter, oldInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	newHeader, err := store.getParsedHeaderOf(ctx, filter, newInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sort []*SortDimension
+	for _, dimension := range oldHeader.Dimensions {
+		if newHeader.Dimension(dimension.Name) == nil {
+			return nil, ErrIncompatibleInstances
+		}
+		sort = append(sort, &SortDimension{Name: strings.ToLower(dimension.Name)})
+	}
+
+	if len(oldHeader.Dimensions) != len(newHeader.Dimensions) {
+		return nil, ErrIncompatibleInstances
+	}
+
+	// aggregated rows only have the dimensions they are grouped by
+	if filter.Aggregation != nil {
+		sort = nil
+		for _, name := range filter.Aggregation.GroupBy {
+			sort = append(sort, &SortDimension{Name: strings.ToLower(name)})
+		}
+	}
+
+	oldReader, err := store.GetCSVRows(ctx, comparisonFilter(filter, oldInstanceID, sort), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	newReader, err := store.GetCSVRows(ctx, comparisonFilter(filter, newInstanceID, sort), nil)
+	if err != nil {
+		oldReader.Close()
+		return nil, err
+	}
+
+	reader, err := NewComparisonRowReader(oldReader, newReader, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	// errors are reported for the new instance, which the old one is compared against
+	return reader.forFilter(comparisonFilter(filter, newInstanceID, sort)), nil
+}
+
+// getParsedHeaderOf returns the parsed header of the given instance, reporting errors for the filter.
+func (store *Store) getParsedHeaderOf(ctx context.Context, filter *Filter, instanceID string) (*Header, error) {
+	row, err := store.GetHeader(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := ParseHeader(row)
+	if err != nil {
+		return nil, newError(err, comparisonFilter(filter, instanceID, nil), nil)
+	}
+
+	return header, nil
+}
+
+// comparisonFilter returns a copy of the filter for the given instance, sorted on the given dimensions.
+func comparisonFilter(filter *Filter, instanceID string, sort []*SortDimension) *Filter {
+	compared := *filter
+	compared.InstanceID = instanceID
+	compared.Sort = sort
+	compared.Projection = nil
+
+	return &compared
+}
+
+// ComparisonRowReader merges the rows of two instances, matching the rows with the same dimension options.
+// The rows of both readers must be sorted on the codes of the given dimensions, in order.
+type ComparisonRowReader struct {
+	old, new   *comparisonSide
+	filter     *Filter
+	header     string // the header row, until it has been read
+	err        error  // the error returned by Read once the rows have been read or have failed
+	closed     bool
+	closeErr   error
+	dimensions int
+}
+
+// comparisonSide is the current row of one of the instances being compared.
+type comparisonSide struct {
+	reader       CSVRowReader
+	codeColumns  []int // the columns of the codes of the sort dimensions, in sort order
+	labelColumns []int
+	width        int      // the number of fields a row needs to hold the sort dimensions
+	fields       []string // the fields of the current row, or nil once all the rows have been read
+}
+
+// NewComparisonRowReader returns a reader comparing the rows of the old and new readers, whose first rows
+// must be the headers of their instances. The headers are read before the reader is returned.
+func NewComparisonRowReader(oldReader, newReader CSVRowReader, sort []*SortDimension) (*ComparisonRowReader, error) {
+	reader := &ComparisonRowReader{
+		old:        &comparisonSide{reader: oldReader},
+		new:        &comparisonSide{reader: newReader},
+		dimensions: len(sort),
+	}
+
+	oldHeader, err := reader.old.readHeader(sort)
+	if err == nil {
+		_, err = reader.new.readHeader(sort)
+	}
+	if err == nil {
+		err = reader.old.next()
+	}
+	if err == nil {
+		err = reader.new.next()
+	}
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	var columns []string
+	for i := range sort {
+		columns = append(columns, oldHeader.Columns[reader.old.codeColumns[i]], oldHeader.Columns[reader.old.labelColumns[i]])
+	}
+
+	reader.header, err = formatCSVRow(append(columns, comparisonColumns...))
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// forFilter sets the filter the rows are being compared for.
+func (reader *ComparisonRowReader) forFilter(filter *Filter) *ComparisonRowReader {
+	reader.filter = filter
+	return reader
+}
+
+// readHeader reads the header row of the instance, finding the columns of the sort dimensions.
+func (side *comparisonSide) readHeader(sort []*SortDimension) (*Header, error) {
+	row, err := side.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := ParseHeader(row)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dimension := range sort {
+		headerDimension := header.Dimension(dimension.Name)
+		if headerDimension == nil {
+			return nil, ErrIncompatibleInstances
+		}
+		side.codeColumns = append(side.codeColumns, headerDimension.CodeListColumn)
+		side.labelColumns = append(side.labelColumns, headerDimension.LabelColumn)
+		if headerDimension.LabelColumn >= side.width {
+			side.width = headerDimension.LabelColumn + 1
+		}
+	}
+
+	return header, nil
+}
+
+// next reads the next row of the instance. An instance without observations has no rows to compare.
+func (side *comparisonSide) next() error {
+	row, err := side.reader.Read()
+	if err == io.EOF || errors.Is(err, ErrNoResultsFound) {
+		side.fields = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fields, err := parseCSVRow(row)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) < side.width {
+		return ErrInvalidHeader
+	}
+
+	side.fields = fields
+	return nil
+}
+
+// compare returns a negative number if the current row of the side is before the current row of the other
+// side, zero if they have the same dimension options, and a positive number if it is after. A side with no
+// more rows is after any row.
+func (side *comparisonSide) compare(other *comparisonSide) int {
+	switch {
+	case side.fields == nil && other.fields == nil:
+		return 0
+	case side.fields == nil:
+		return 1
+	case other.fields == nil:
+		return -1
+	}
+
+	for i := range side.codeColumns {
+		if c := strings.Compare(side.fields[side.codeColumns[i]], other.fields[other.codeColumns[i]]); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// Read the next row of the comparison, or return io.EOF. The reader is closed once io.EOF or an error is
+// returned. An *Error matching ErrNoResultsFound is returned after the header if neither instance has any
+// rows.
+func (reader *ComparisonRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	if reader.closed {
+		return "", ErrReaderClosed
+	}
+
+	if reader.header != "" {
+		header := reader.header
+		reader.header = ""
+
+		if reader.old.fields == nil && reader.new.fields == nil {
+			reader.err = newError(ErrNoResultsFound, reader.filter, nil)
+			reader.Close()
+		}
+
+		return header, nil
+	}
+
+	row, err := reader.read()
+	if err != nil {
+		reader.err = err
+		reader.Close()
+		return "", err
+	}
+
+	return row, nil
+}
+
+func (reader *ComparisonRowReader) read() (string, error) {
+	if reader.old.fields == nil && reader.new.fields == nil {
+		return "", io.EOF
+	}
+
+	var oldFields, newFields []string
+	switch c := reader.old.compare(reader.new); {
+	case c < 0:
+		oldFields = reader.old.fields
+	case c > 0:
+		newFields = reader.new.fields
+	default:
+		oldFields, newFields = reader.old.fields, reader.new.fields
+	}
+
+	fields := make([]string, 0, 2*reader.dimensions+len(comparisonColumns))
+
+	// the labels of the new instance are used if the observation is in both
+	side := reader.old
+	if newFields != nil {
+		side = reader.new
+	}
+	for i := range side.codeColumns {
+		fields = append(fields, side.fields[side.codeColumns[i]], side.fields[side.labelColumns[i]])
+	}
+
+	fields = append(fields, compareObservations(oldFields, newFields)...)
+
+	if oldFields != nil {
+		if err := reader.old.next(); err != nil {
+			return "", err
+		}
+	}
+	if newFields != nil {
+		if err := reader.new.next(); err != nil {
+			return "", err
+		}
+	}
+
+	return formatCSVRow(fields)
+}
+
+// compareObservations returns the old and new observations of the rows, the difference between them and
+// the status of the comparison. A nil row is an observation that is missing from its instance.
+func compareObservations(oldFields, newFields []string) []string {
+	switch {
+	case oldFields == nil:
+		return []string{"", newFields[0], "", ComparisonAdded}
+	case newFields == nil:
+		return []string{oldFields[0], "", "", ComparisonRemoved}
+	}
+
+	oldObservation, newObservation := oldFields[0], newFields[0]
+
+	oldValue, oldErr := strconv.ParseFloat(oldObservation, 64)
+	newValue, newErr := strconv.ParseFloat(newObservation, 64)
+	if oldErr != nil || newErr != nil {
+		status := ComparisonChanged
+		if oldObservation == newObservation {
+			status = ComparisonUnchanged
+		}
+		return []string{oldObservation, newObservation, "", status}
+	}
+
+	status := ComparisonChanged
+	if oldValue == newValue {
+		status = ComparisonUnchanged
+	}
+
+	// the difference is rounded to the precision of the observations, to hide floating point errors
+	precision := decimalPlaces(oldObservation)
+	if p := decimalPlaces(newObservation); p < 0 || (precision >= 0 && p > precision) {
+		precision = p
+	}
+
+	return []string{oldObservation, newObservation, strconv.FormatFloat(newValue-oldValue, 'f', precision, 64), status}
+}
+
+// decimalPlaces returns the number of decimal places of a number, or -1 if it is in exponent form.
+func decimalPlaces(number string) int {
+	if strings.ContainsAny(number, "eE") {
+		return -1
+	}
+
+	if i := strings.IndexByte(number, '.'); i >= 0 {
+		return len(number) - i - 1
+	}
+
+	return 0
+}
+
+// Close both of the underlying readers. Closing the reader more than once has no further effect.
+func (reader *ComparisonRowReader) Close() error {
+	if !reader.closed {
+		reader.closed = true
+		reader.closeErr = combineErrors(reader.old.reader.Close(), reader.new.reader.Close())
+	}
+
+	return reader.closeErr
+}
@@ -0,0 +1,226 @@
+package observation_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var comparisonSort = []*observation.SortDimension{{Name: "age"}, {Name: "sex"}}
+
+func TestComparisonRowReader_Read(t *testing.T) {
+
+	Convey("Given readers of the sorted rows of two instances", t, func() {
+
+		oldReader := newMockRowReader(
+			"V4_0,age_codelist,age,sex_codelist,sex\n",
+			"10,29,29,female,Female\n",
+			"11,29,29,male,Male\n",
+			"0.1,30,30,female,Female\n",
+		)
+
+		// the new instance has its dimensions in a different order and a row that is not in the old instance
+		newReader := newMockRowReader(
+			"V4_0,sex_codelist,sex,age_codelist,age\n",
+			"10,female,Female,29,29\n",
+			"12.5,male,Male,29,29 years\n",
+			"0.3,female,Female,30,30\n",
+			"x,female,Female,31,31\n",
+		)
+
+		Convey("When the comparison is read", func() {
+
+			reader, err := observation.NewComparisonRowReader(oldReader, newReader, comparisonSort)
+			So(err, ShouldBeNil)
+			rows, err := readAllRows(reader)
+
+			Convey("The rows with the same dimension options are merged, with the difference between them", func() {
+				So(err, ShouldBeNil)
+				So(rows, ShouldResemble, []string{
+					"age_codelist,age,sex_codelist,sex,old_observation,new_observation,difference,status\n",
+					"29,29,female,Female,10,10,0,unchanged\n",
+					"29,29 years,male,Male,11,12.5,1.5,changed\n",
+					"30,30,female,Female,0.1,0.3,0.2,changed\n",
+					"31,31,female,Female,,x,,added\n",
+				})
+			})
+
+			Convey("Both readers are closed", func() {
+				So(len(oldReader.CloseCalls()), ShouldEqual, 1)
+				So(len(newReader.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a new instance without any observations", t, func() {
+
+		oldReader := newMockRowReader(
+			"V4_0,age_codelist,age,sex_codelist,sex\n",
+			"10,29,29,female,Female\n",
+		)
+		newRows := []string{"V4_0,age_codelist,age,sex_codelist,sex\n"}
+		newReader := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				if len(newRows) == 0 {
+					return "", observation.ErrNoResultsFound
+				}
+				row := newRows[0]
+				newRows = newRows[1:]
+				return row, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		Convey("When the comparison is read", func() {
+
+			reader, err := observation.NewComparisonRowReader(oldReader, newReader, comparisonSort)
+			So(err, ShouldBeNil)
+			rows, err := readAllRows(reader)
+
+			Convey("The observations of the old instance are removed", func() {
+				So(err, ShouldBeNil)
+				So(rows[1:], ShouldResemble, []string{"29,29,female,Female,10,,,removed\n"})
+			})
+		})
+	})
+
+	Convey("Given instances with different dimensions", t, func() {
+
+		oldReader := newMockRowReader("V4_0,age_codelist,age,sex_codelist,sex\n")
+		newReader := newMockRowReader("V4_0,age_codelist,age,geography_codelist,geography\n")
+
+		Convey("When a comparison reader is created", func() {
+
+			reader, err := observation.NewComparisonRowReader(oldReader, newReader, comparisonSort)
+
+			Convey("ErrIncompatibleInstances is returned and both readers are closed", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrIncompatibleInstances)
+				So(len(oldReader.CloseCalls()), ShouldEqual, 1)
+				So(len(newReader.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetComparison(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection holding two versions of an instance", t, func() {
+
+		headers := map[string]string{
+			"old": "V4_0,age_codelist,age",
+			"new": "V4_0,age_codelist,age",
+		}
+		observations := map[string][]string{
+			"old": {"1,29,29", "2,30,30"},
+			"new": {"1,29,29", "3,30,30"},
+		}
+
+		instanceOf := func(query string) string {
+			if strings.Contains(query, "_old_") {
+				return "old"
+			}
+			return "new"
+		}
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{headers[instanceOf(query)]}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				rows := observations[instanceOf(query)]
+				return &observationtest.BoltRowsMock{
+					NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+						if len(rows) == 0 {
+							return nil, nil, io.EOF
+						}
+						row := rows[0]
+						rows = rows[1:]
+						return []interface{}{row}, nil, nil
+					},
+					CloseFunc: func() error {
+						return nil
+					},
+				}, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+		filter := &observation.Filter{
+			DimensionFilters: []*observation.DimensionFilter{{Name: "age", Options: []string{"29", "30"}}},
+		}
+
+		Convey("When GetComparison is called", func() {
+
+			reader, err := store.GetComparison(testContext, filter, "old", "new")
+			So(err, ShouldBeNil)
+			rows, err := readAllRows(reader)
+
+			Convey("The observations of both instances are queried sorted on their dimensions", func() {
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 2)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEndWith, "ORDER BY `age`.value, o.value")
+				So(mockedDBConnection.QueryNeoCalls()[1].Query, ShouldContainSubstring, "`_new_age`")
+			})
+
+			Convey("The comparison of the observations is returned", func() {
+				So(err, ShouldBeNil)
+				So(rows, ShouldResemble, []string{
+					"age_codelist,age,old_observation,new_observation,difference,status\n",
+					"29,29,1,1,0,unchanged\n",
+					"30,30,2,3,1,changed\n",
+				})
+			})
+
+			Convey("The filter is not modified", func() {
+				So(filter.InstanceID, ShouldEqual, "")
+				So(filter.Sort, ShouldBeNil)
+			})
+		})
+
+		Convey("When GetComparison is called for instances without any observations", func() {
+
+			observations["old"], observations["new"] = nil, nil
+			filter.FilterID = "filter-1"
+			reader, err := store.GetComparison(testContext, filter, "old", "new")
+			So(err, ShouldBeNil)
+			_, err = readAllRows(reader)
+
+			Convey("An *observation.Error matching ErrNoResultsFound is returned for the new instance", func() {
+				var filterErr *observation.Error
+				So(errors.As(err, &filterErr), ShouldBeTrue)
+				So(errors.Is(err, observation.ErrNoResultsFound), ShouldBeTrue)
+				So(filterErr.InstanceID, ShouldEqual, "new")
+				So(filterErr.FilterID, ShouldEqual, "filter-1")
+			})
+		})
+
+		Convey("When GetComparison is called for instances with different dimensions", func() {
+
+			headers["new"] = "V4_0,sex_codelist,sex"
+			reader, err := store.GetComparison(testContext, filter, "old", "new")
+
+			Convey("ErrIncompatibleInstances is returned without querying the observations", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrIncompatibleInstances)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,124 @@
+package observation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoDataReturned is returned if a Neo4j row has no data.
+var ErrNoDataReturned = errors.New("no data returned in this row")
+
+// ErrUnrecognisedType is returned if a Neo4j row does not have the expected string value.
+var ErrUnrecognisedType = errors.New("the value returned was not a string")
+
+// ErrNoInstanceFound is returned if no instance exists in neo4j
+var ErrNoInstanceFound = errors.New("no instance found in datastore")
+
+// ErrNoHeaderFound is returned if the instance exists but does not have a header
+var ErrNoHeaderFound = errors.New("the instance has no header")
+
+// ErrNoResultsFound is returned if the selected filter options produce no results
+var ErrNoResultsFound = errors.New("the filter options created no results")
+
+// ErrDriver is returned if the database driver fails to open a connection, run a query or read a row
+var ErrDriver = errors.New("the database driver returned an error")
+
+// Error describes a failure to read the observations of an instance. It matches the sentinel error
+// describing the failure when compared using errors.Is, and unwraps to the driver error that caused it.
+type Error struct {
+	Err        error // the sentinel error describing the failure
+	InstanceID string
+	FilterID   string
+	Cause      error // the driver error that caused the failure, if any
+}
+
+// newError returns a new error for the given filter.
+func newError(err error, filter *Filter, cause error) *Error {
+	e := &Error{
+		Err:   err,
+		Cause: cause,
+	}
+
+	if filter != nil {
+		e.InstanceID = filter.InstanceID
+		e.FilterID = filter.FilterID
+	}
+
+	return e
+}
+
+// Error returns the description of the failure along with the instance and filter it occurred for.
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+
+	return fmt.Sprintf("%s (instance_id=%q, filter_id=%q)", msg, e.InstanceID, e.FilterID)
+}
+
+// Is returns true if the target is the sentinel error describing the failure.
+func (e *Error) Is(target error) bool {
+	return target == e.Err
+}
+
+// Unwrap returns the driver error that caused the failure, if any.
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// MultiError holds the errors of several operations that were all attempted, e.g. closing both the rows and
+// the connection of a reader. It matches any of its errors when compared using errors.Is or errors.As.
+type MultiError []error
+
+// combineErrors returns nil if all of the errors are nil, the only error if there is one, or a MultiError.
+func combineErrors(errs ...error) error {
+	var multi MultiError
+	for _, err := range errs {
+		if err != nil {
+			multi = append(multi, err)
+		}
+	}
+
+	switch len(multi) {
+	case 0:
+		return nil
+	case 1:
+		return multi[0]
+	}
+
+	return multi
+}
+
+// Error returns the descriptions of the errors.
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Is returns true if any of the errors matches the target.
+func (e MultiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first of the errors that matches the target, and if so, sets the target to it.
+func (e MultiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,191 @@
+package observation
+
+import (
+	"context"
+	"io"
+)
+
+// Query is a statement and its parameters, as sent to the database.
+type Query struct {
+	Statement  string                 `json:"statement"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// Plan summarises an operator of the execution plan of a query, and the operators that feed it.
+type Plan struct {
+	Operator      string   `json:"operator"`
+	Identifiers   []string `json:"identifiers,omitempty"`
+	EstimatedRows float64  `json:"estimated_rows"`
+	Rows          int64    `json:"rows,omitempty"`    // only set when profiled
+	DBHits        int64    `json:"db_hits,omitempty"` // only set when profiled
+	Children      []*Plan  `json:"children,omitempty"`
+}
+
+// TotalDBHits returns the database hits of the operator and all of the operators that feed it.
+func (plan *Plan) TotalDBHits() int64 {
+	total := plan.DBHits
+	for _, child := range plan.Children {
+		total += child.TotalDBHits()
+	}
+
+	return total
+}
+
+// GetQuery returns the observation query GetCSVRows would run for the filter, without running it. The
+// database is only used if the filter requests a complete grid, as its query is sorted on every dimension
+// of the instance.
+func (store *Store) GetQuery(ctx context.Context, filter *Filter, limit *int) (*Query, error) {
+	if err := store.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	if filter.Sparsity == nil {
+		return createQuery(filter, limit), nil
+	}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	header, err := getHeader(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return createQueryForHeader(filter, header, limit)
+}
+
+// createQueryForHeader returns the observation query for the filter on the instance with the given header
+// row, checking its sort dimensions and sorting a complete grid on every dimension.
+func createQueryForHeader(filter *Filter, header string, limit *int) (*Query, error) {
+	if err := CheckSortDimensions(filter, header); err != nil {
+		return nil, err
+	}
+
+	if filter.Sparsity != nil {
+		parsed, err := ParseHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		filter = newGridFilter(filter, parsed)
+	}
+
+	return createQuery(filter, limit), nil
+}
+
+// Explain returns the execution plan of the observation query for the filter. If profile is false the
+// query is not run and the plan only includes estimates. If profile is true the query is run, discarding
+// its rows, and the plan includes the rows and database hits of each operator. The filter is checked as it
+// is by GetCSVRows, including the estimated rows limit before the query is profiled.
+func (store *Store) Explain(ctx context.Context, filter *Filter, limit *int, profile bool) (*Plan, error) {
+	if err := store.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	header, err := getHeader(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := createQueryForHeader(filter, header, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile {
+		if err := store.limits.checkEstimatedRows(conn, filter, header); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix, key := "EXPLAIN ", "plan"
+	if profile {
+		prefix, key = "PROFILE ", "profile"
+	}
+
+	rows, err := conn.QueryNeo(prefix+query.Statement, query.Parameters)
+	if err != nil {
+		return nil, newDriverError(filter, err)
+	}
+	defer rows.Close()
+
+	// the plan is in the metadata returned once all of the rows have been read
+	for {
+		_, metadata, err := rows.NextNeo()
+		if err == io.EOF {
+			plan, ok := metadata[key].(map[string]interface{})
+			if !ok {
+				return nil, newError(ErrNoDataReturned, filter, nil)
+			}
+			return parsePlan(plan), nil
+		}
+		if err != nil {
+			return nil, newDriverError(filter, err)
+		}
+	}
+}
+
+// parsePlan converts the plan metadata returned by the database.
+func parsePlan(metadata map[string]interface{}) *Plan {
+	plan := &Plan{}
+
+	plan.Operator, _ = metadata["operatorType"].(string)
+	plan.Rows = toInt64(metadata["rows"])
+	plan.DBHits = toInt64(metadata["dbHits"])
+
+	if args, ok := metadata["args"].(map[string]interface{}); ok {
+		plan.EstimatedRows = toFloat64(args["EstimatedRows"])
+	}
+
+	if identifiers, ok := metadata["identifiers"].([]interface{}); ok {
+		for _, identifier := range identifiers {
+			if name, ok := identifier.(string); ok {
+				plan.Identifiers = append(plan.Identifiers, name)
+			}
+		}
+	}
+
+	if children, ok := metadata["children"].([]interface{}); ok {
+		for _, child := range children {
+			if childMetadata, ok := child.(map[string]interface{}); ok {
+				plan.Children = append(plan.Children, parsePlan(childMetadata))
+			}
+		}
+	}
+
+	return plan
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+
+	return 0
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+
+	return 0
+}
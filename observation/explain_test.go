@@ -0,0 +1,195 @@
+package observation_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var explainFilter = &observation.Filter{
+	InstanceID: "888",
+	DimensionFilters: []*observation.DimensionFilter{
+		{Name: "age", Options: []string{"29"}},
+	},
+}
+
+const explainQuery = "MATCH (o)-[:isValueOf]->(`age`:`_888_age`) WHERE (`age`.value='29') RETURN o.value AS row"
+
+func TestStore_GetQuery(t *testing.T) {
+
+	Convey("Given a store with a mock DB pool", t, func() {
+
+		mockedPool := &observationtest.DBPoolMock{}
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetQuery is called with a limit", func() {
+
+			limit := 10
+			query, err := store.GetQuery(testContext, explainFilter, &limit)
+
+			Convey("The generated query is returned without using the database", func() {
+				So(err, ShouldBeNil)
+				So(query.Statement, ShouldEqual, explainQuery+" LIMIT 10")
+				So(query.Parameters, ShouldBeNil)
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a store with a mock DB connection returning the header of an instance", t, func() {
+
+		mockedDBConnection := newHeaderConnection()
+		store := observation.NewStore(&observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		})
+
+		Convey("When GetQuery is called for a complete grid", func() {
+
+			filter := *explainFilter
+			filter.Sort = []*observation.SortDimension{{Name: "sex", Descending: true}}
+			filter.Sparsity = &observation.Sparsity{}
+			query, err := store.GetQuery(testContext, &filter, nil)
+
+			Convey("The query is sorted on every dimension, as it is by GetCSVRows", func() {
+				So(err, ShouldBeNil)
+				So(query.Statement, ShouldEndWith, " ORDER BY `sex`.value DESC, `age`.value, o.value")
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_Explain(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection returning a query plan", t, func() {
+
+		rows := [][]interface{}{{"1,29,29"}, {"2,29,29"}}
+		summary := map[string]interface{}{
+			"plan": map[string]interface{}{
+				"operatorType": "ProduceResults",
+				"identifiers":  []interface{}{"o", "row"},
+				"args":         map[string]interface{}{"EstimatedRows": 2.5},
+				"children": []interface{}{
+					map[string]interface{}{
+						"operatorType": "NodeByLabelScan",
+						"args":         map[string]interface{}{"EstimatedRows": 10.0},
+					},
+				},
+			},
+			"profile": map[string]interface{}{
+				"operatorType": "ProduceResults",
+				"rows":         int64(2),
+				"dbHits":       int64(4),
+				"children": []interface{}{
+					map[string]interface{}{
+						"operatorType": "NodeByLabelScan",
+						"rows":         int64(10),
+						"dbHits":       int64(11),
+					},
+				},
+			},
+		}
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				if len(rows) == 0 {
+					return nil, summary, io.EOF
+				}
+				row := rows[0]
+				rows = rows[1:]
+				return row, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				if strings.Contains(query, "count(d)") {
+					return [][]interface{}{{int64(100)}}, nil, nil, nil
+				}
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return mockBoltRows, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When Explain is called", func() {
+
+			plan, err := store.Explain(testContext, explainFilter, nil, false)
+
+			Convey("The query is explained and the estimated plan returned", func() {
+				So(err, ShouldBeNil)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEqual, "EXPLAIN "+explainQuery)
+				So(plan, ShouldResemble, &observation.Plan{
+					Operator:      "ProduceResults",
+					Identifiers:   []string{"o", "row"},
+					EstimatedRows: 2.5,
+					Children: []*observation.Plan{
+						{Operator: "NodeByLabelScan", EstimatedRows: 10},
+					},
+				})
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When Explain is called with profiling", func() {
+
+			plan, err := store.Explain(testContext, explainFilter, nil, true)
+
+			Convey("The query is profiled, its rows discarded and the profiled plan returned", func() {
+				So(err, ShouldBeNil)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEqual, "PROFILE "+explainQuery)
+				So(len(mockBoltRows.NextNeoCalls()), ShouldEqual, 3)
+				So(plan.Rows, ShouldEqual, 2)
+				So(plan.TotalDBHits(), ShouldEqual, 15)
+				So(len(mockBoltRows.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When Explain is called with profiling on a store whose estimated rows limit the filter exceeds", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLimits(observation.Limits{MaxEstimatedRows: 50}))
+			_, err := store.Explain(testContext, explainFilter, nil, true)
+
+			Convey("ErrLimitExceeded is returned without profiling the query", func() {
+				So(errors.Is(err, observation.ErrLimitExceeded), ShouldBeTrue)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When Explain is called with a sort dimension that is not in the header", func() {
+
+			filter := *explainFilter
+			filter.Sort = []*observation.SortDimension{{Name: "time"}}
+			_, err := store.Explain(testContext, &filter, nil, false)
+
+			Convey("ErrUnknownDimension is returned without explaining the query", func() {
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -1,5 +1,13 @@
 package observation
 
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidSort is returned if a sort dimension has no name or is specified more than once.
+var ErrInvalidSort = errors.New("sort dimensions must be named and only specified once")
+
 // Boolean indicators for publish flag
 var (
 	Published   = true
@@ -13,6 +21,10 @@ type Filter struct {
 	DimensionFilters []*DimensionFilter `json:"dimensions,omitempty"`
 	Published        *bool              `json:"published,omitempty"`
 	Downloads        *Downloads         `json:"downloads,omitempty"`
+	Projection       *Projection        `json:"projection,omitempty"`
+	Sort             []*SortDimension   `json:"sort,omitempty"`
+	Aggregation      *Aggregation       `json:"aggregation,omitempty"`
+	Sparsity         *Sparsity          `json:"sparsity,omitempty"`
 }
 
 // DimensionFilter represents an object containing a list of dimension values and the dimension name
@@ -21,6 +33,21 @@ type DimensionFilter struct {
 	Options []string `json:"options,omitempty"`
 }
 
+// Projection specifies which dimension columns are written to the output. If Include is set then only the
+// named dimensions are written, otherwise every dimension not named in Exclude is written. The observation
+// and metadata columns are always written.
+type Projection struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// SortDimension specifies a dimension to order the output by, using the code of each option. Rows are
+// ordered by each sort dimension in turn.
+type SortDimension struct {
+	Name       string `json:"name"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
 // Downloads represent a list of download types
 type Downloads struct {
 	CSV *DownloadItem `json:"csv,omitempty"`
@@ -50,3 +77,39 @@ func (f Filter) IsEmpty() bool {
 
 	return true
 }
+
+// Validate checks the options of the filter that cannot be checked by the database.
+func (filter *Filter) Validate() error {
+	if filter.Projection != nil {
+		if err := filter.Projection.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateSort(filter.Sort); err != nil {
+		return err
+	}
+
+	if filter.Aggregation != nil {
+		if filter.Sparsity != nil {
+			return ErrInvalidSparsity
+		}
+		return filter.Aggregation.Validate(filter.Sort)
+	}
+
+	return nil
+}
+
+// validateSort checks that each of the given sort dimensions is named and unique.
+func validateSort(sort []*SortDimension) error {
+	names := make(map[string]bool, len(sort))
+
+	for _, dimension := range sort {
+		if dimension == nil || dimension.Name == "" || names[strings.ToLower(dimension.Name)] {
+			return ErrInvalidSort
+		}
+		names[strings.ToLower(dimension.Name)] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package observation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Fingerprint returns a hash identifying the output of the filter. Filters that differ only in their ID,
+// publish state, downloads, the order of their dimensions and options or in duplicated and empty values
+// have the same fingerprint, so can be used to find existing downloads for an identical filter.
+func (f Filter) Fingerprint() string {
+	canonical := Filter{
+		InstanceID:       f.InstanceID,
+		DimensionFilters: f.DimensionFilters,
+		Sort:             f.Sort,
+	}
+	canonical.Normalise()
+
+	if f.Aggregation != nil {
+		canonical.Aggregation = &Aggregation{
+			GroupBy:  f.Aggregation.GroupBy,
+			Function: strings.ToLower(f.Aggregation.Function),
+		}
+	}
+
+	if f.Sparsity != nil {
+		missing, suppressed := f.Sparsity.Markers()
+		canonical.Sparsity = &Sparsity{
+			MissingMarker:    missing,
+			SuppressedMarker: suppressed,
+		}
+	}
+
+	if f.Projection != nil {
+		canonical.Projection = &Projection{
+			Include: sortedUnique(f.Projection.Include),
+			Exclude: sortedUnique(f.Projection.Exclude),
+		}
+	}
+
+	// marshalling a filter cannot fail as it only contains strings, bools and slices of them
+	b, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
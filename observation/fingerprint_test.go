@@ -0,0 +1,76 @@
+package observation_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFilter_Fingerprint(t *testing.T) {
+
+	Convey("Given a filter with dimensions and options", t, func() {
+
+		filter := observation.Filter{
+			FilterID:   "123",
+			InstanceID: "888",
+			DimensionFilters: []*observation.DimensionFilter{
+				{Name: "age", Options: []string{"29", "30"}},
+				{Name: "sex", Options: []string{"male", "female"}},
+			},
+			Published: &observation.Published,
+		}
+
+		Convey("When it is compared with an equivalent filter with a different order, duplicates and empty values", func() {
+
+			equivalent := observation.Filter{
+				FilterID:   "456",
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "sex", Options: []string{"female", "male", "female"}},
+					{Name: "", Options: []string{"x"}},
+					{Name: "time", Options: []string{}},
+					{Name: "age", Options: []string{"30", "", "29"}},
+				},
+				Published: &observation.Unpublished,
+			}
+
+			Convey("The fingerprints are the same", func() {
+				So(equivalent.Fingerprint(), ShouldEqual, filter.Fingerprint())
+			})
+		})
+
+		Convey("When it is compared with a filter for a different instance", func() {
+
+			other := filter
+			other.InstanceID = "999"
+
+			Convey("The fingerprints are different", func() {
+				So(other.Fingerprint(), ShouldNotEqual, filter.Fingerprint())
+			})
+		})
+
+		Convey("When it is compared with a filter with different options", func() {
+
+			other := filter
+			other.DimensionFilters = []*observation.DimensionFilter{
+				{Name: "age", Options: []string{"29"}},
+				{Name: "sex", Options: []string{"male", "female"}},
+			}
+
+			Convey("The fingerprints are different", func() {
+				So(other.Fingerprint(), ShouldNotEqual, filter.Fingerprint())
+			})
+		})
+
+		Convey("When it is compared with a filter that is sorted", func() {
+
+			other := filter
+			other.Sort = []*observation.SortDimension{{Name: "age"}}
+
+			Convey("The fingerprints are different", func() {
+				So(other.Fingerprint(), ShouldNotEqual, filter.Fingerprint())
+			})
+		})
+	})
+}
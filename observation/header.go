@@ -0,0 +1,126 @@
+package observation
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidHeader is returned if an instance header row is not in the expected V4 format.
+var ErrInvalidHeader = errors.New("the instance header is not a valid V4 header")
+
+// ErrUnknownDimension is returned if a dimension is referenced that does not exist in the instance header.
+var ErrUnknownDimension = errors.New("the dimension does not exist in the instance header")
+
+const v4Prefix = "V4_"
+
+// Header describes the columns of an instance header row. A V4 header starts with a "V4_n" column
+// holding the observation, followed by n metadata columns (e.g. data markings), followed by a pair
+// of code list and label columns for each dimension.
+type Header struct {
+	Columns         []string
+	MetadataColumns int
+	Dimensions      []*HeaderDimension
+}
+
+// HeaderDimension identifies the columns of a single dimension within a header.
+type HeaderDimension struct {
+	Name           string
+	CodeListColumn int
+	LabelColumn    int
+}
+
+// ParseHeader parses the given CSV header row.
+func ParseHeader(row string) (*Header, error) {
+	columns, err := parseCSVRow(row)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	if len(columns) == 0 || !strings.HasPrefix(strings.ToUpper(columns[0]), v4Prefix) {
+		return nil, ErrInvalidHeader
+	}
+
+	metadataColumns, err := strconv.Atoi(columns[0][len(v4Prefix):])
+	if err != nil || metadataColumns < 0 {
+		return nil, ErrInvalidHeader
+	}
+
+	dimensionOffset := 1 + metadataColumns
+	if len(columns) < dimensionOffset || (len(columns)-dimensionOffset)%2 != 0 {
+		return nil, ErrInvalidHeader
+	}
+
+	header := &Header{
+		Columns:         columns,
+		MetadataColumns: metadataColumns,
+	}
+
+	for i := dimensionOffset; i < len(columns); i += 2 {
+		header.Dimensions = append(header.Dimensions, &HeaderDimension{
+			Name:           columns[i+1],
+			CodeListColumn: i,
+			LabelColumn:    i + 1,
+		})
+	}
+
+	return header, nil
+}
+
+// Dimension returns the dimension with the given name, ignoring case, or nil if it does not exist.
+func (header *Header) Dimension(name string) *HeaderDimension {
+	for _, dimension := range header.Dimensions {
+		if strings.EqualFold(dimension.Name, name) {
+			return dimension
+		}
+	}
+
+	return nil
+}
+
+// DimensionNames returns the names of the dimensions in the order they appear in the header.
+func (header *Header) DimensionNames() []string {
+	names := make([]string, 0, len(header.Dimensions))
+	for _, dimension := range header.Dimensions {
+		names = append(names, dimension.Name)
+	}
+
+	return names
+}
+
+// ObservationColumns returns the number of leading columns that hold the observation and its metadata.
+func (header *Header) ObservationColumns() int {
+	return 1 + header.MetadataColumns
+}
+
+// parseCSVRow splits a single CSV row, as returned by a CSVRowReader, into its fields.
+func parseCSVRow(row string) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(row))
+	reader.FieldsPerRecord = -1
+
+	fields, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// formatCSVRow joins the given fields into a single CSV row terminated by a new line.
+func formatCSVRow(fields []string) (string, error) {
+	var buf bytes.Buffer
+
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(fields); err != nil {
+		return "", err
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,57 @@
+package observation_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseHeader(t *testing.T) {
+
+	Convey("Given a V4 header row with a data marking column and two dimensions", t, func() {
+
+		row := "V4_1,Data_Marking,calendar-years,Time,uk-only,Geography\n"
+
+		Convey("When the header is parsed", func() {
+
+			header, err := observation.ParseHeader(row)
+
+			Convey("The observation and dimension columns are identified", func() {
+				So(err, ShouldBeNil)
+				So(header.MetadataColumns, ShouldEqual, 1)
+				So(header.ObservationColumns(), ShouldEqual, 2)
+				So(header.DimensionNames(), ShouldResemble, []string{"Time", "Geography"})
+
+				geography := header.Dimension("geography")
+				So(geography, ShouldNotBeNil)
+				So(geography.CodeListColumn, ShouldEqual, 4)
+				So(geography.LabelColumn, ShouldEqual, 5)
+
+				So(header.Dimension("age"), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given header rows that are not in the V4 format", t, func() {
+
+		rows := []string{
+			"",
+			"observation,time_codelist,time\n",
+			"V4_x,time_codelist,time\n",
+			"V4_0,time_codelist\n",
+			"V4_3,Data_Marking\n",
+		}
+
+		Convey("When the headers are parsed", func() {
+
+			Convey("The expected error is returned", func() {
+				for _, row := range rows {
+					header, err := observation.ParseHeader(row)
+					So(err, ShouldEqual, observation.ErrInvalidHeader)
+					So(header, ShouldBeNil)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,154 @@
+package observation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Statuses reported by a health check.
+const (
+	StatusOK       = "OK"
+	StatusWarning  = "WARNING"
+	StatusCritical = "CRITICAL"
+)
+
+// Messages reported by a health check.
+const (
+	MsgHealthy  = "neo4j is healthy"
+	MsgSlow     = "neo4j is responding slowly"
+	MsgNoResult = "neo4j returned no result to the health check query"
+)
+
+// healthCheckQuery is a trivial query, used to check that the database is answering queries.
+const healthCheckQuery = "RETURN 1"
+
+// Default timeouts of a health check, unless WithHealthCheck is used.
+const (
+	defaultHealthCheckTimeout   = 5 * time.Second
+	defaultHealthCheckWarnAfter = 2 * time.Second
+)
+
+// HealthCheck configures the health check of a store.
+type HealthCheck struct {
+	Timeout   time.Duration // the time to open a connection and run the health check query within
+	WarnAfter time.Duration // the time after which a successful check is reported as a warning
+}
+
+// WithHealthCheck returns an option setting the timeouts of the health check of the store.
+func WithHealthCheck(check HealthCheck) Option {
+	return func(store *Store) {
+		store.healthCheck = check
+	}
+}
+
+// CheckState is the result of the latest health check. It is safe to update and read concurrently.
+type CheckState struct {
+	mutex       sync.RWMutex
+	status      string
+	message     string
+	duration    time.Duration
+	lastChecked time.Time
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+// CheckResult is a snapshot of a CheckState.
+type CheckResult struct {
+	Status      string        `json:"status"`
+	Message     string        `json:"message"`
+	Duration    time.Duration `json:"duration"`
+	LastChecked time.Time     `json:"last_checked"`
+	LastSuccess time.Time     `json:"last_success,omitempty"`
+	LastFailure time.Time     `json:"last_failure,omitempty"`
+}
+
+// Update records the result of a health check. A warning is a success as the database is available.
+func (state *CheckState) Update(status, message string, duration time.Duration) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	now := time.Now().UTC()
+	state.status = status
+	state.message = message
+	state.duration = duration
+	state.lastChecked = now
+
+	if status == StatusCritical {
+		state.lastFailure = now
+	} else {
+		state.lastSuccess = now
+	}
+}
+
+// Result returns the result of the latest health check.
+func (state *CheckState) Result() CheckResult {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	return CheckResult{
+		Status:      state.status,
+		Message:     state.message,
+		Duration:    state.duration,
+		LastChecked: state.lastChecked,
+		LastSuccess: state.lastSuccess,
+		LastFailure: state.lastFailure,
+	}
+}
+
+// Checker checks that a connection can be opened from the pool and used to run a trivial query within the
+// health check timeout, updating the state with the result. The check is CRITICAL if it fails, in which
+// case the error is also returned, WARNING if it succeeds after the warning time, and OK otherwise.
+func (store *Store) Checker(ctx context.Context, state *CheckState) error {
+	start := time.Now()
+
+	timeout := store.healthCheck.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	warnAfter := store.healthCheck.WarnAfter
+	if warnAfter <= 0 {
+		warnAfter = defaultHealthCheckWarnAfter
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := store.ping(ctx); err != nil {
+		state.Update(StatusCritical, err.Error(), time.Since(start))
+		return err
+	}
+
+	duration := time.Since(start)
+	if duration > warnAfter {
+		state.Update(StatusWarning, fmt.Sprintf("%s: the check took %s", MsgSlow, duration), duration)
+		return nil
+	}
+
+	state.Update(StatusOK, MsgHealthy, duration)
+	return nil
+}
+
+// ping runs the health check query using a connection from the pool.
+func (store *Store) ping(ctx context.Context) error {
+	filter := &Filter{}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	data, _, _, err := conn.QueryNeoAll(healthCheckQuery, nil)
+	if err != nil {
+		return newDriverError(filter, err)
+	}
+
+	if len(data) == 0 {
+		return newError(ErrNoDataReturned, filter, errors.New(MsgNoResult))
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package observation_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore_Checker(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{int64(1)}}, nil, nil, nil
+			},
+			SetTimeoutFunc: func(in1 time.Duration) {},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		state := &observation.CheckState{}
+
+		Convey("When the health check succeeds", func() {
+
+			store := observation.NewStore(mockedPool)
+			err := store.Checker(testContext, state)
+
+			Convey("The state is OK and the connection is released back into the pool", func() {
+				So(err, ShouldBeNil)
+				result := state.Result()
+				So(result.Status, ShouldEqual, observation.StatusOK)
+				So(result.Message, ShouldEqual, observation.MsgHealthy)
+				So(result.LastSuccess, ShouldEqual, result.LastChecked)
+				So(result.LastFailure.IsZero(), ShouldBeTrue)
+				So(mockedDBConnection.QueryNeoAllCalls()[0].Query, ShouldEqual, "RETURN 1")
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+
+			Convey("The health check timeout is set on the connection", func() {
+				So(mockedDBConnection.SetTimeoutCalls()[0].In1, ShouldBeBetweenOrEqual, 4*time.Second, 5*time.Second)
+			})
+		})
+
+		Convey("When the health check succeeds after the warning time", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithHealthCheck(observation.HealthCheck{
+				WarnAfter: time.Nanosecond,
+			}))
+			err := store.Checker(testContext, state)
+
+			Convey("The state is WARNING", func() {
+				So(err, ShouldBeNil)
+				So(state.Result().Status, ShouldEqual, observation.StatusWarning)
+				So(state.Result().Message, ShouldStartWith, observation.MsgSlow)
+			})
+		})
+
+		Convey("When the health check query fails", func() {
+
+			mockedDBConnection.QueryNeoAllFunc = func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return nil, nil, nil, errors.New("broken")
+			}
+			store := observation.NewStore(mockedPool)
+			err := store.Checker(testContext, state)
+
+			Convey("The state is CRITICAL and the error is returned", func() {
+				So(errors.Is(err, observation.ErrDriver), ShouldBeTrue)
+				result := state.Result()
+				So(result.Status, ShouldEqual, observation.StatusCritical)
+				So(result.Message, ShouldEqual, err.Error())
+				So(result.LastFailure, ShouldEqual, result.LastChecked)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a connection cannot be opened", func() {
+
+			mockedPool.OpenPoolFunc = func() (bolt.Conn, error) {
+				return nil, errors.New("no connection")
+			}
+			store := observation.NewStore(mockedPool)
+			err := store.Checker(testContext, state)
+
+			Convey("The state is CRITICAL", func() {
+				So(errors.Is(err, observation.ErrDriver), ShouldBeTrue)
+				So(state.Result().Status, ShouldEqual, observation.StatusCritical)
+			})
+		})
+
+		Convey("When a connection is not opened within the health check timeout", func() {
+
+			mockedPool.OpenPoolFunc = func() (bolt.Conn, error) {
+				time.Sleep(50 * time.Millisecond)
+				return mockedDBConnection, nil
+			}
+			store := observation.NewStore(mockedPool, observation.WithHealthCheck(observation.HealthCheck{
+				Timeout: 10 * time.Millisecond,
+			}))
+			err := store.Checker(testContext, state)
+
+			Convey("The state is CRITICAL and the error matches ErrTimeout", func() {
+				So(errors.Is(err, observation.ErrTimeout), ShouldBeTrue)
+				So(state.Result().Status, ShouldEqual, observation.StatusCritical)
+			})
+		})
+	})
+}
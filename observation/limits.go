@@ -0,0 +1,187 @@
+package observation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// ErrLimitExceeded is returned if a filter would create a query larger than the limits of the store.
+var ErrLimitExceeded = errors.New("the filter exceeds the query limits")
+
+// Names of the limits reported by LimitError.
+const (
+	LimitOptionsPerDimension = "max_options_per_dimension"
+	LimitTotalOptions        = "max_total_options"
+	LimitEstimatedRows       = "max_estimated_rows"
+)
+
+// Limits restricts the size of the queries run by a store, so that a single filter cannot degrade the
+// database for everyone else. A limit of zero or less is unlimited.
+type Limits struct {
+	MaxOptionsPerDimension int   // the maximum number of options selected for any one dimension
+	MaxTotalOptions        int   // the maximum number of options selected across all dimensions
+	MaxEstimatedRows       int64 // the maximum number of rows the query could return
+}
+
+// WithLimits returns an option that rejects filters exceeding the given limits before they are queried.
+func WithLimits(limits Limits) Option {
+	return func(store *Store) {
+		store.limits = limits
+	}
+}
+
+// LimitError is returned if a filter exceeds one of the limits of the store. It matches ErrLimitExceeded
+// when compared using errors.Is.
+type LimitError struct {
+	Limit      string // the name of the limit that was exceeded
+	Max        int64
+	Actual     int64
+	Dimension  string // the dimension that exceeded the limit, if the limit is per dimension
+	InstanceID string
+	FilterID   string
+}
+
+// Error describes the limit that was exceeded.
+func (e *LimitError) Error() string {
+	msg := fmt.Sprintf("%s: %s is %d but the filter has %d", ErrLimitExceeded, e.Limit, e.Max, e.Actual)
+	if e.Dimension != "" {
+		msg += fmt.Sprintf(" for dimension %q", e.Dimension)
+	}
+
+	return fmt.Sprintf("%s (instance_id=%q, filter_id=%q)", msg, e.InstanceID, e.FilterID)
+}
+
+// Is returns true if the target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func newLimitError(filter *Filter, limit string, max, actual int64, dimension string) *LimitError {
+	return &LimitError{
+		Limit:      limit,
+		Max:        max,
+		Actual:     actual,
+		Dimension:  dimension,
+		InstanceID: filter.InstanceID,
+		FilterID:   filter.FilterID,
+	}
+}
+
+// CheckOptions checks the number of options selected by the filter against the limits, for backends
+// running the queries built by the store.
+func (limits Limits) CheckOptions(filter *Filter) error {
+	return limits.checkOptionLimits(filter)
+}
+
+// CheckEstimatedRows checks the number of rows the filter could return against the limits, for backends
+// running the queries built by the store. The header row is that of the filtered instance, and count
+// returns the number of options of a dimension, named as in the graph. Count is only called if the limits
+// restrict the estimated rows.
+func (limits Limits) CheckEstimatedRows(filter *Filter, header string, count func(dimension string) (int64, error)) error {
+	return limits.estimateRows(filter, header, count)
+}
+
+// checkOptionLimits checks the number of options selected by the filter against the limits.
+func (limits Limits) checkOptionLimits(filter *Filter) error {
+	if limits.MaxOptionsPerDimension <= 0 && limits.MaxTotalOptions <= 0 {
+		return nil
+	}
+
+	normalised := Filter{DimensionFilters: filter.DimensionFilters}
+	normalised.Normalise()
+
+	total := 0
+	for _, dimension := range normalised.DimensionFilters {
+		options := len(dimension.Options)
+		if limits.MaxOptionsPerDimension > 0 && options > limits.MaxOptionsPerDimension {
+			return newLimitError(filter, LimitOptionsPerDimension, int64(limits.MaxOptionsPerDimension), int64(options), dimension.Name)
+		}
+		total += options
+	}
+
+	if limits.MaxTotalOptions > 0 && total > limits.MaxTotalOptions {
+		return newLimitError(filter, LimitTotalOptions, int64(limits.MaxTotalOptions), int64(total), "")
+	}
+
+	return nil
+}
+
+// checkEstimatedRows checks the number of rows the filter could return against the limits. The estimate
+// is the product of the number of options selected for each dimension, using the number of options of
+// the dimension if none are selected, so is the most rows the query could return.
+func (limits Limits) checkEstimatedRows(conn bolt.Conn, filter *Filter, header string) error {
+	return limits.estimateRows(filter, header, func(dimension string) (int64, error) {
+		return countOptions(conn, filter, dimension)
+	})
+}
+
+// estimateRows checks the estimated rows of the filter, using count to find the number of options of the
+// dimensions that are not filtered.
+func (limits Limits) estimateRows(filter *Filter, header string, count func(dimension string) (int64, error)) error {
+	if limits.MaxEstimatedRows <= 0 {
+		return nil
+	}
+
+	parsed, err := ParseHeader(header)
+	if err != nil {
+		return err
+	}
+
+	normalised := Filter{DimensionFilters: filter.DimensionFilters}
+	normalised.Normalise()
+
+	selected := make(map[string]int64)
+	for _, dimension := range normalised.DimensionFilters {
+		selected[strings.ToLower(dimension.Name)] = int64(len(dimension.Options))
+	}
+
+	estimate := int64(1)
+	for _, name := range parsed.DimensionNames() {
+		name = strings.ToLower(name)
+
+		options, ok := selected[name]
+		if !ok {
+			if options, err = count(name); err != nil {
+				return err
+			}
+		}
+
+		estimate *= options
+		if estimate > limits.MaxEstimatedRows {
+			return newLimitError(filter, LimitEstimatedRows, limits.MaxEstimatedRows, estimate, "")
+		}
+	}
+
+	return nil
+}
+
+// NewCountOptionsQuery returns the query for the number of options of a dimension of the given instance.
+func NewCountOptionsQuery(instanceID, dimension string) *Query {
+	return &Query{
+		Statement: fmt.Sprintf("MATCH (d:`_%s_%s`) RETURN count(d) AS count", instanceID, dimension),
+	}
+}
+
+// countOptions returns the number of options of the given dimension.
+func countOptions(conn bolt.Conn, filter *Filter, dimension string) (int64, error) {
+	query := NewCountOptionsQuery(filter.InstanceID, dimension)
+
+	data, _, _, err := conn.QueryNeoAll(query.Statement, query.Parameters)
+	if err != nil {
+		return 0, newDriverError(filter, err)
+	}
+
+	if len(data) == 0 || len(data[0]) == 0 {
+		return 0, newError(ErrNoDataReturned, filter, nil)
+	}
+
+	count, ok := data[0][0].(int64)
+	if !ok {
+		return 0, newError(ErrUnrecognisedType, filter, nil)
+	}
+
+	return count, nil
+}
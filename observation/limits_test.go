@@ -0,0 +1,137 @@
+package observation_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore_GetCSVRowsLimits(t *testing.T) {
+
+	Convey("Given a store with limits and a mock DB connection", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				if strings.HasSuffix(query, "RETURN i.header as row") {
+					return [][]interface{}{{expectedHeader}}, nil, nil, nil
+				}
+				// every dimension has 100 options
+				return [][]interface{}{{int64(100)}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return &observationtest.BoltRowsMock{}, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool, observation.WithLimits(observation.Limits{
+			MaxOptionsPerDimension: 3,
+			MaxTotalOptions:        4,
+			MaxEstimatedRows:       250,
+		}))
+
+		Convey("When GetCSVRows is called with too many options for a dimension", func() {
+
+			filter := &observation.Filter{
+				FilterID:   "123",
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"1", "2", "3", "4", "4"}},
+				},
+			}
+
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The limit error is returned without querying the database", func() {
+				So(rowReader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrLimitExceeded), ShouldBeTrue)
+
+				var limitErr *observation.LimitError
+				So(errors.As(err, &limitErr), ShouldBeTrue)
+				So(*limitErr, ShouldResemble, observation.LimitError{
+					Limit:      observation.LimitOptionsPerDimension,
+					Max:        3,
+					Actual:     4,
+					Dimension:  "age",
+					InstanceID: "888",
+					FilterID:   "123",
+				})
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When GetCSVRows is called with too many options in total", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"1", "2", "3"}},
+					{Name: "sex", Options: []string{"male", "female"}},
+				},
+			}
+
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The limit error is returned", func() {
+				var limitErr *observation.LimitError
+				So(errors.As(err, &limitErr), ShouldBeTrue)
+				So(limitErr.Limit, ShouldEqual, observation.LimitTotalOptions)
+				So(limitErr.Actual, ShouldEqual, 5)
+			})
+		})
+
+		Convey("When GetCSVRows is called with a filter estimated to return too many rows", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"1", "2", "3"}},
+				},
+			}
+
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The options of the unfiltered dimension are counted and the limit error is returned", func() {
+				var limitErr *observation.LimitError
+				So(errors.As(err, &limitErr), ShouldBeTrue)
+				So(limitErr.Limit, ShouldEqual, observation.LimitEstimatedRows)
+				So(limitErr.Actual, ShouldEqual, 300)
+
+				So(mockedDBConnection.QueryNeoAllCalls()[1].Query, ShouldEqual, "MATCH (d:`_888_sex`) RETURN count(d) AS count")
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetCSVRows is called with a filter within the limits", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"1", "2"}},
+				},
+			}
+
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The observations are queried", func() {
+				So(err, ShouldBeNil)
+				So(rowReader, ShouldNotBeNil)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
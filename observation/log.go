@@ -0,0 +1,153 @@
+package observation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Level is the severity of a log event.
+type Level int
+
+// Severities of the log events of the store, from least to most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Logger receives the log events of the store. The data of an event must not be modified.
+type Logger interface {
+	Log(ctx context.Context, level Level, event string, data map[string]interface{}, err error)
+}
+
+// nopLogger discards all log events. It is the logger of a store unless WithLogger is used, so a store logs
+// nothing by default.
+type nopLogger struct{}
+
+func (nopLogger) Log(ctx context.Context, level Level, event string, data map[string]interface{}, err error) {
+}
+
+// QueryLogMode determines how the statement of a query is included in its log event.
+type QueryLogMode int
+
+// Ways the statement of a query can be logged.
+const (
+	QueryLogFull      QueryLogMode = iota // the whole statement
+	QueryLogTruncated                     // the first MaxQueryLength bytes of the statement
+	QueryLogHashed                        // a SHA-256 hash of the statement, to correlate events without the statement
+	QueryLogNone                          // only the length of the statement
+)
+
+// defaultMaxQueryLength is the length truncated queries are logged to if LogPolicy.MaxQueryLength is not set.
+const defaultMaxQueryLength = 1024
+
+// redactedOption replaces the option values of queries that are redacted.
+const redactedOption = "<redacted>"
+
+// LogPolicy determines which events a store logs and what they include.
+type LogPolicy struct {
+	Level                 Level        // the minimum severity of the events that are logged
+	QueryLevel            Level        // the severity the queries run are logged at
+	Query                 QueryLogMode // how the statement of a query is logged
+	MaxQueryLength        int          // the length truncated queries are logged to
+	LogUnpublishedOptions bool         // log the option values of filters not known to be published, which are otherwise redacted
+}
+
+// DefaultLogPolicy returns the log policy of a store unless WithLogPolicy is used. Queries are sent to the
+// logger at info level, with the option values of unpublished filters redacted. Nothing is logged unless
+// WithLogger is also used: services that relied on the "neo4j query" events logged through log.Event can
+// keep them with WithLogger(onslog.New()).
+func DefaultLogPolicy() LogPolicy {
+	return LogPolicy{
+		Level:      LevelInfo,
+		QueryLevel: LevelInfo,
+		Query:      QueryLogFull,
+	}
+}
+
+// WithLogger returns an option sending the log events of the store to the given logger.
+func WithLogger(logger Logger) Option {
+	return func(store *Store) {
+		store.logger = logger
+	}
+}
+
+// WithLogPolicy returns an option setting the log policy of the store.
+func WithLogPolicy(policy LogPolicy) Option {
+	return func(store *Store) {
+		store.logPolicy = policy
+	}
+}
+
+// log sends an event to the logger of the store if it meets the minimum level of the log policy.
+func (store *Store) log(ctx context.Context, level Level, event string, data map[string]interface{}, err error) {
+	if level < store.logPolicy.Level {
+		return
+	}
+
+	store.logger.Log(ctx, level, event, data, err)
+}
+
+// logQuery logs the query run for the filter according to the log policy of the store.
+func (store *Store) logQuery(ctx context.Context, filter *Filter, limit *int, query *Query) {
+	policy := store.logPolicy
+	if policy.QueryLevel < policy.Level {
+		return
+	}
+
+	statement := query.Statement
+	if !policy.LogUnpublishedOptions && !isPublished(filter) {
+		statement = createQuery(redactOptions(filter), limit).Statement
+	}
+
+	data := map[string]interface{}{
+		"filterID":    filter.FilterID,
+		"instanceID":  filter.InstanceID,
+		"queryLength": len(query.Statement),
+	}
+
+	switch policy.Query {
+	case QueryLogFull:
+		data["query"] = statement
+	case QueryLogTruncated:
+		max := policy.MaxQueryLength
+		if max <= 0 {
+			max = defaultMaxQueryLength
+		}
+		if len(statement) > max {
+			statement = statement[:max] + "...(truncated " + strconv.Itoa(len(statement)-max) + " bytes)"
+		}
+		data["query"] = statement
+	case QueryLogHashed:
+		// the hash is of the statement that was run, so it is the same whether or not the statement is redacted
+		sum := sha256.Sum256([]byte(query.Statement))
+		data["queryHash"] = hex.EncodeToString(sum[:])
+	}
+
+	store.logger.Log(ctx, policy.QueryLevel, "neo4j query", data, nil)
+}
+
+// isPublished returns true if the filter is known to be of a published instance.
+func isPublished(filter *Filter) bool {
+	return filter.Published != nil && *filter.Published
+}
+
+// redactOptions returns a copy of the filter with the value of each option replaced, so that the query
+// created for it shows the shape of the query but none of the data selected.
+func redactOptions(filter *Filter) *Filter {
+	redacted := *filter
+	redacted.DimensionFilters = make([]*DimensionFilter, len(filter.DimensionFilters))
+
+	for i, dimension := range filter.DimensionFilters {
+		options := make([]string, len(dimension.Options))
+		for j := range options {
+			options[j] = redactedOption
+		}
+		redacted.DimensionFilters[i] = &DimensionFilter{Name: dimension.Name, Options: options}
+	}
+
+	return &redacted
+}
@@ -0,0 +1,141 @@
+package observation_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore_GetCSVRowsLogging(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection and a mock logger", t, func() {
+
+		filter := &observation.Filter{
+			InstanceID: "888",
+			DimensionFilters: []*observation.DimensionFilter{
+				{Name: "age", Options: []string{"29", "30"}},
+			},
+		}
+
+		query := "MATCH (o)-[:isValueOf]->(`age`:`_888_age`) WHERE (`age`.value='29' OR `age`.value='30') RETURN o.value AS row"
+		redactedQuery := "MATCH (o)-[:isValueOf]->(`age`:`_888_age`) " +
+			"WHERE (`age`.value='<redacted>' OR `age`.value='<redacted>') RETURN o.value AS row"
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return &observationtest.BoltRowsMock{}, nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		mockedLogger := &observationtest.LoggerMock{
+			LogFunc: func(ctx context.Context, level observation.Level, event string, data map[string]interface{}, err error) {
+			},
+		}
+
+		Convey("When GetCSVRows is called for a published filter with the default log policy", func() {
+
+			filter.Published = &observation.Published
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger))
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The full query is logged at info level", func() {
+				So(err, ShouldBeNil)
+				So(len(mockedLogger.LogCalls()), ShouldEqual, 1)
+				call := mockedLogger.LogCalls()[0]
+				So(call.Level, ShouldEqual, observation.LevelInfo)
+				So(call.Event, ShouldEqual, "neo4j query")
+				So(call.Data["query"], ShouldEqual, query)
+				So(call.Data["queryLength"], ShouldEqual, len(query))
+				So(call.Data["instanceID"], ShouldEqual, "888")
+			})
+		})
+
+		Convey("When GetCSVRows is called for an unpublished filter with the default log policy", func() {
+
+			filter.Published = &observation.Unpublished
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger))
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The query is logged with its option values redacted", func() {
+				So(err, ShouldBeNil)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEqual, query)
+				So(mockedLogger.LogCalls()[0].Data["query"], ShouldEqual, redactedQuery)
+			})
+		})
+
+		Convey("When GetCSVRows is called for an unpublished filter with a policy logging unpublished options", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger), observation.WithLogPolicy(observation.LogPolicy{
+				LogUnpublishedOptions: true,
+			}))
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The full query is logged", func() {
+				So(err, ShouldBeNil)
+				So(mockedLogger.LogCalls()[0].Data["query"], ShouldEqual, query)
+			})
+		})
+
+		Convey("When GetCSVRows is called with a policy that truncates queries", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger), observation.WithLogPolicy(observation.LogPolicy{
+				QueryLevel:     observation.LevelDebug,
+				Query:          observation.QueryLogTruncated,
+				MaxQueryLength: 10,
+			}))
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The truncated query is logged at the query level of the policy, with its option values redacted", func() {
+				So(err, ShouldBeNil)
+				call := mockedLogger.LogCalls()[0]
+				So(call.Level, ShouldEqual, observation.LevelDebug)
+				So(call.Data["query"], ShouldEqual, "MATCH (o)-...(truncated 115 bytes)")
+			})
+		})
+
+		Convey("When GetCSVRows is called with a policy that hashes queries", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger), observation.WithLogPolicy(observation.LogPolicy{
+				Query: observation.QueryLogHashed,
+			}))
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The hash of the query run is logged instead of the query", func() {
+				So(err, ShouldBeNil)
+				sum := sha256.Sum256([]byte(query))
+				data := mockedLogger.LogCalls()[0].Data
+				So(data["queryHash"], ShouldEqual, hex.EncodeToString(sum[:]))
+				So(data, ShouldNotContainKey, "query")
+			})
+		})
+
+		Convey("When GetCSVRows is called with a policy whose level is above the query level", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger), observation.WithLogPolicy(observation.LogPolicy{
+				Level:      observation.LevelWarn,
+				QueryLevel: observation.LevelInfo,
+			}))
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The query is not logged", func() {
+				So(err, ShouldBeNil)
+				So(len(mockedLogger.LogCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
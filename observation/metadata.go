@@ -0,0 +1,186 @@
+package observation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// DimensionOption represents an option of a dimension and the number of observations that have it.
+type DimensionOption struct {
+	Code  string `json:"code"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// GetDimensions returns the names of the dimensions of the given instance, in the order they appear in the
+// instance header. Names are lower case, as used for the dimension nodes in the graph.
+func (store *Store) GetDimensions(ctx context.Context, instanceID string) ([]string, error) {
+	header, err := store.GetParsedHeader(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := header.DimensionNames()
+	for i := range names {
+		names[i] = strings.ToLower(names[i])
+	}
+
+	return names, nil
+}
+
+// GetOptions returns the options of a dimension of the given instance, ordered by code, along with the
+// number of observations for each option.
+func (store *Store) GetOptions(ctx context.Context, instanceID, dimension string) ([]*DimensionOption, error) {
+	filter := &Filter{InstanceID: instanceID}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	header, err := getParsedHeader(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Dimension(dimension) == nil {
+		return nil, ErrUnknownDimension
+	}
+
+	// graph labels are lower case, as returned by GetDimensions
+	query := fmt.Sprintf("MATCH (d:`_%s_%s`) OPTIONAL MATCH (o)-[:isValueOf]->(d) "+
+		"RETURN d.value AS code, d.label AS label, count(o) AS count ORDER BY code", instanceID, strings.ToLower(dimension))
+
+	return queryOptions(conn, filter, query)
+}
+
+// GetParsedHeader returns the header of the given instance, parsed to identify its dimension columns.
+func (store *Store) GetParsedHeader(ctx context.Context, instanceID string) (*Header, error) {
+	filter := &Filter{InstanceID: instanceID}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return getParsedHeader(conn, filter)
+}
+
+// getParsedHeader queries and parses the header of the filtered instance using the given connection.
+func getParsedHeader(conn bolt.Conn, filter *Filter) (*Header, error) {
+	row, err := getHeader(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseHeader(row)
+}
+
+// queryOptions runs a query returning the code, label and count of dimension options.
+func queryOptions(conn bolt.Conn, filter *Filter, query string) ([]*DimensionOption, error) {
+	data, _, _, err := conn.QueryNeoAll(query, nil)
+	if err != nil {
+		return nil, newDriverError(filter, err)
+	}
+
+	options := make([]*DimensionOption, 0, len(data))
+	for _, row := range data {
+		if len(row) < 3 {
+			return nil, newError(ErrNoDataReturned, filter, nil)
+		}
+
+		code, ok := row[0].(string)
+		if !ok {
+			return nil, newError(ErrUnrecognisedType, filter, nil)
+		}
+
+		// not every option has a label
+		label, _ := row[1].(string)
+
+		count, ok := row[2].(int64)
+		if !ok {
+			return nil, newError(ErrUnrecognisedType, filter, nil)
+		}
+
+		options = append(options, &DimensionOption{
+			Code:  code,
+			Label: label,
+			Count: count,
+		})
+	}
+
+	return options, nil
+}
+
+// AvailableDimension lists the options of a dimension that have observations matching a filter.
+type AvailableDimension struct {
+	Name    string             `json:"name"`
+	Options []*DimensionOption `json:"options"`
+}
+
+// GetAvailableOptions returns, for each dimension of the instance that the filter does not select options
+// for, the options that still have observations matching the filter along with their number of
+// observations. Options without matching observations are not returned, so can be disabled by a UI. The
+// filter is checked against the limits of the store, as each dimension's options are counted from the
+// observations the filter matches.
+func (store *Store) GetAvailableOptions(ctx context.Context, filter *Filter) ([]*AvailableDimension, error) {
+	if err := store.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	row, err := getHeader(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.limits.checkEstimatedRows(conn, filter, row); err != nil {
+		return nil, err
+	}
+
+	header, err := ParseHeader(row)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make(map[string]bool)
+	for name := range filteredDimensions(filter) {
+		filtered[strings.ToLower(name)] = true
+	}
+
+	matches, where := createFilterClauses(filter)
+
+	var available []*AvailableDimension
+	for _, name := range header.DimensionNames() {
+		name = strings.ToLower(name)
+		if filtered[name] {
+			continue
+		}
+
+		dimensionMatches := append(matches[:len(matches):len(matches)], createDimensionMatch(filter.InstanceID, name))
+		query := createMatchQuery(dimensionMatches, where) +
+			fmt.Sprintf(" RETURN `%s`.value AS code, `%s`.label AS label, count(o) AS count ORDER BY code", name, name)
+
+		options, err := queryOptions(conn, filter, query)
+		if err != nil {
+			return nil, err
+		}
+
+		available = append(available, &AvailableDimension{
+			Name:    name,
+			Options: options,
+		})
+	}
+
+	return available, nil
+}
@@ -0,0 +1,206 @@
+package observation_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore_GetDimensions(t *testing.T) {
+
+	Convey("Given an store with a mock DB connection", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{"V4_1,Data_Marking,calendar-years,Time,uk-only,Geography"}}, nil, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetDimensions is called", func() {
+
+			dimensions, err := store.GetDimensions(testContext, "888")
+
+			Convey("The dimensions in the instance header are returned", func() {
+				So(err, ShouldBeNil)
+				So(dimensions, ShouldResemble, []string{"time", "geography"})
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetOptions(t *testing.T) {
+
+	Convey("Given an store with a mock DB connection", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				if query == "MATCH (i:`_888_Instance`) RETURN i.header as row" {
+					return [][]interface{}{{expectedHeader}}, nil, nil, nil
+				}
+				return [][]interface{}{
+					{"female", "Female", int64(12)},
+					{"male", nil, int64(10)},
+				}, nil, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetOptions is called for a dimension of the instance", func() {
+
+			options, err := store.GetOptions(testContext, "888", "sex")
+
+			Convey("The options of the dimension are queried and returned", func() {
+				So(err, ShouldBeNil)
+				So(options, ShouldResemble, []*observation.DimensionOption{
+					{Code: "female", Label: "Female", Count: 12},
+					{Code: "male", Count: 10},
+				})
+
+				So(len(mockedDBConnection.QueryNeoAllCalls()), ShouldEqual, 2)
+				So(mockedDBConnection.QueryNeoAllCalls()[1].Query, ShouldEqual, "MATCH (d:`_888_sex`) "+
+					"OPTIONAL MATCH (o)-[:isValueOf]->(d) "+
+					"RETURN d.value AS code, d.label AS label, count(o) AS count ORDER BY code")
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetOptions is called for a dimension named in a different case", func() {
+
+			_, err := store.GetOptions(testContext, "888", "Sex")
+
+			Convey("The options of the lower case dimension are queried", func() {
+				So(err, ShouldBeNil)
+				So(mockedDBConnection.QueryNeoAllCalls()[1].Query, ShouldStartWith, "MATCH (d:`_888_sex`) ")
+			})
+		})
+
+		Convey("When GetOptions is called for a dimension that is not in the instance", func() {
+
+			options, err := store.GetOptions(testContext, "888", "time")
+
+			Convey("The expected error is returned without querying options", func() {
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(options, ShouldBeNil)
+				So(len(mockedDBConnection.QueryNeoAllCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetAvailableOptions(t *testing.T) {
+
+	Convey("Given an store with a mock DB connection for an instance with three dimensions", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				if query == "MATCH (i:`_888_Instance`) RETURN i.header as row" {
+					return [][]interface{}{{"V4_0,age_codelist,Age,sex_codelist,Sex,time_codelist,Time"}}, nil, nil, nil
+				}
+				if strings.Contains(query, "count(d)") {
+					return [][]interface{}{{int64(10)}}, nil, nil, nil
+				}
+				return [][]interface{}{{"a", "A", int64(2)}}, nil, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetAvailableOptions is called with a filter selecting options of one dimension", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"29", "30"}},
+					{Name: "time", Options: []string{}},
+				},
+			}
+
+			available, err := store.GetAvailableOptions(testContext, filter)
+
+			Convey("The options of each other dimension matching the filter are queried and returned", func() {
+				So(err, ShouldBeNil)
+				So(available, ShouldResemble, []*observation.AvailableDimension{
+					{Name: "sex", Options: []*observation.DimensionOption{{Code: "a", Label: "A", Count: 2}}},
+					{Name: "time", Options: []*observation.DimensionOption{{Code: "a", Label: "A", Count: 2}}},
+				})
+
+				calls := mockedDBConnection.QueryNeoAllCalls()
+				So(len(calls), ShouldEqual, 3)
+				So(calls[1].Query, ShouldEqual, "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) "+
+					"WHERE (`age`.value='29' OR `age`.value='30') "+
+					"RETURN `sex`.value AS code, `sex`.label AS label, count(o) AS count ORDER BY code")
+				So(calls[2].Query, ShouldEqual, "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`time`:`_888_time`) "+
+					"WHERE (`age`.value='29' OR `age`.value='30') "+
+					"RETURN `time`.value AS code, `time`.label AS label, count(o) AS count ORDER BY code")
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetAvailableOptions is called on a store with option limits the filter exceeds", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLimits(observation.Limits{MaxOptionsPerDimension: 1}))
+			_, err := store.GetAvailableOptions(testContext, &observation.Filter{
+				InstanceID:       "888",
+				DimensionFilters: []*observation.DimensionFilter{{Name: "age", Options: []string{"29", "30"}}},
+			})
+
+			Convey("ErrLimitExceeded is returned without using the database", func() {
+				So(errors.Is(err, observation.ErrLimitExceeded), ShouldBeTrue)
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When GetAvailableOptions is called on a store with an estimated rows limit the filter exceeds", func() {
+
+			store := observation.NewStore(mockedPool, observation.WithLimits(observation.Limits{MaxEstimatedRows: 100}))
+			_, err := store.GetAvailableOptions(testContext, &observation.Filter{
+				InstanceID:       "888",
+				DimensionFilters: []*observation.DimensionFilter{{Name: "age", Options: []string{"29", "30"}}},
+			})
+
+			Convey("ErrLimitExceeded is returned without counting the available options", func() {
+				So(errors.Is(err, observation.ErrLimitExceeded), ShouldBeTrue)
+				for _, call := range mockedDBConnection.QueryNeoAllCalls() {
+					So(call.Query, ShouldNotContainSubstring, "count(o)")
+				}
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
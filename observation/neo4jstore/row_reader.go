@@ -0,0 +1,111 @@
+package neo4jstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// rowReader translates the records of a Neo4j result to CSV rows, returning the header of the instance
+// before the observations.
+type rowReader struct {
+	ctx      context.Context
+	header   string
+	session  neo4j.Session
+	result   neo4j.Result
+	filter   *observation.Filter
+	rowsRead int
+	err      error // the error returned by each call to Read once the rows have been read or have failed
+	closed   bool
+	closeErr error
+}
+
+func newRowReader(ctx context.Context, header string, session neo4j.Session, result neo4j.Result, filter *observation.Filter) *rowReader {
+	return &rowReader{
+		ctx:     ctx,
+		header:  header,
+		session: session,
+		result:  result,
+		filter:  filter,
+	}
+}
+
+// Read the next row, or return io.EOF. Errors other than io.EOF, and other than the context being
+// cancelled, are returned as an *observation.Error. The reader is closed once io.EOF or an error is
+// returned, and the same error is returned by each later call. observation.ErrReaderClosed is returned if
+// the reader was closed before then.
+func (reader *rowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	if reader.closed {
+		return "", observation.ErrReaderClosed
+	}
+
+	row, err := reader.read()
+	if err != nil {
+		reader.err = err
+		// the error of closing the session is returned by Close, as it does not affect the rows read
+		reader.Close()
+		return "", err
+	}
+
+	return row, nil
+}
+
+func (reader *rowReader) read() (string, error) {
+	if reader.rowsRead == 0 {
+		reader.rowsRead++
+		return reader.header + "\n", nil
+	}
+
+	if err := contextError(reader.ctx, reader.filter); err != nil {
+		return "", err
+	}
+
+	if !reader.result.Next() {
+		if err := reader.result.Err(); err != nil {
+			return "", driverError(reader.filter, err)
+		}
+		if reader.rowsRead == 1 {
+			return "", newError(observation.ErrNoResultsFound, reader.filter, nil)
+		}
+		return "", io.EOF
+	}
+
+	values := reader.result.Record().Values
+	if len(values) < 1 {
+		return "", newError(observation.ErrNoDataReturned, reader.filter, nil)
+	}
+
+	if reader.filter.Aggregation != nil {
+		csvRow, err := observation.FormatAggregatedRow(values)
+		if err != nil {
+			return "", newError(err, reader.filter, nil)
+		}
+		reader.rowsRead++
+		return csvRow + "\n", nil
+	}
+
+	csvRow, ok := values[0].(string)
+	if !ok {
+		return "", newError(observation.ErrUnrecognisedType, reader.filter, nil)
+	}
+
+	reader.rowsRead++
+	return csvRow + "\n", nil
+}
+
+// Close the session, discarding any rows that have not been read. Closing the reader more than once has no
+// further effect.
+func (reader *rowReader) Close() error {
+	if !reader.closed {
+		reader.closed = true
+		reader.closeErr = reader.session.Close()
+	}
+
+	return reader.closeErr
+}
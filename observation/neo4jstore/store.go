@@ -0,0 +1,300 @@
+// Package neo4jstore provides the observations of a filter using the official Neo4j Go driver, which
+// supports Bolt 4+, routing in causal clusters and bookmarks. It runs the same queries as the observation
+// store, and its row readers return the same rows and errors, so it can replace the store without changing
+// the code that reads the rows. The limits of the store are set using WithLimits. There is no log policy, as
+// only the IDs of a filter and the length of its query are logged.
+package neo4jstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// codeTransactionTimedOut is the code of the error returned by Neo4j if a transaction exceeds its timeout.
+const codeTransactionTimedOut = "Neo.ClientError.Transaction.TransactionTimedOut"
+
+// Check that the store conforms to the CSVRowGetter interface.
+var _ observation.CSVRowGetter = (*Store)(nil)
+
+// Driver opens sessions with the database. It is implemented by neo4j.Driver.
+type Driver interface {
+	NewSession(config neo4j.SessionConfig) neo4j.Session
+}
+
+// Store represents storage for observation data, read using the official Neo4j Go driver.
+type Store struct {
+	driver       Driver
+	database     string        // the name of the database to read, or empty for the default database
+	fetchSize    int           // the number of records fetched in each batch, or zero for the driver default
+	queryTimeout time.Duration // the timeout of each transaction, or zero for the server default
+	limits       observation.Limits
+	logger       observation.Logger
+}
+
+// Option configures optional behaviour of a Store.
+type Option func(store *Store)
+
+// WithDatabase returns an option reading the given database instead of the default database.
+func WithDatabase(name string) Option {
+	return func(store *Store) {
+		store.database = name
+	}
+}
+
+// WithFetchSize returns an option setting the number of records fetched from the database in each batch.
+func WithFetchSize(size int) Option {
+	return func(store *Store) {
+		store.fetchSize = size
+	}
+}
+
+// WithQueryTimeout returns an option setting the timeout of each transaction run by the store. A deadline
+// on the context of a call also applies to its transactions.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(store *Store) {
+		store.queryTimeout = timeout
+	}
+}
+
+// WithLimits returns an option that rejects filters exceeding the given limits before they are queried, as
+// observation.WithLimits does for the observation store.
+func WithLimits(limits observation.Limits) Option {
+	return func(store *Store) {
+		store.limits = limits
+	}
+}
+
+// WithLogger returns an option sending the log events of the store to the given logger.
+func WithLogger(logger observation.Logger) Option {
+	return func(store *Store) {
+		store.logger = logger
+	}
+}
+
+// NewStore returns a new store using the given driver and options.
+func NewStore(driver Driver, opts ...Option) *Store {
+	store := &Store{
+		driver: driver,
+	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	return store
+}
+
+// GetCSVRows returns a reader allowing individual CSV rows to be read, as returned by
+// observation.Store.GetCSVRows. The rows are read in a session routed to a reader of the cluster, which
+// waits for any bookmarks set on the context using observation.ContextWithBookmarks. Complete grids of
+// observations are not supported, so filters setting Sparsity return observation.ErrSparsityNotSupported.
+func (store *Store) GetCSVRows(ctx context.Context, filter *observation.Filter, limit *int) (observation.CSVRowReader, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if filter.Sparsity != nil {
+		return nil, observation.ErrSparsityNotSupported
+	}
+
+	if err := store.limits.CheckOptions(filter); err != nil {
+		return nil, err
+	}
+
+	if err := contextError(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	session := store.newSession(ctx)
+
+	header, err := store.getHeader(ctx, session, filter)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	if err := observation.CheckSortDimensions(filter, header); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	err = store.limits.CheckEstimatedRows(filter, header, func(dimension string) (int64, error) {
+		return store.countOptions(ctx, session, filter, dimension)
+	})
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	if filter.Aggregation != nil {
+		if header, err = filter.Aggregation.RewriteHeader(header); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
+	query := observation.NewQuery(filter, limit)
+	store.log(ctx, observation.LevelInfo, "neo4j query", map[string]interface{}{
+		"filterID":    filter.FilterID,
+		"instanceID":  filter.InstanceID,
+		"queryLength": len(query.Statement),
+	})
+
+	result, err := session.Run(query.Statement, query.Parameters, store.txConfig(ctx)...)
+	if err != nil {
+		session.Close()
+		return nil, driverError(filter, err)
+	}
+
+	// The session can only be closed once the results have been read, so the row reader is responsible for
+	// closing it
+	var rowReader observation.CSVRowReader = newRowReader(ctx, header, session, result, filter)
+
+	if filter.Projection != nil {
+		rowReader = observation.NewProjectionRowReader(rowReader, filter.Projection)
+	}
+
+	return rowReader, nil
+}
+
+// GetHeader returns the header row of the given instance, without a trailing new line. If the instance does
+// not exist then an error matching observation.ErrNoInstanceFound is returned.
+func (store *Store) GetHeader(ctx context.Context, instanceID string) (string, error) {
+	filter := &observation.Filter{InstanceID: instanceID}
+
+	if err := contextError(ctx, filter); err != nil {
+		return "", err
+	}
+
+	session := store.newSession(ctx)
+	defer session.Close()
+
+	return store.getHeader(ctx, session, filter)
+}
+
+// getHeader queries the header row of the filtered instance using the given session.
+func (store *Store) getHeader(ctx context.Context, session neo4j.Session, filter *observation.Filter) (string, error) {
+	query := observation.NewHeaderQuery(filter.InstanceID)
+
+	result, err := session.Run(query.Statement, query.Parameters, store.txConfig(ctx)...)
+	if err != nil {
+		return "", driverError(filter, err)
+	}
+
+	if !result.Next() {
+		if err := result.Err(); err != nil {
+			return "", driverError(filter, err)
+		}
+		return "", newError(observation.ErrNoInstanceFound, filter, nil)
+	}
+
+	values := result.Record().Values
+	if len(values) == 0 || values[0] == nil || values[0] == "" {
+		return "", newError(observation.ErrNoHeaderFound, filter, nil)
+	}
+
+	header, ok := values[0].(string)
+	if !ok {
+		return "", newError(observation.ErrUnrecognisedType, filter, nil)
+	}
+
+	if _, err := result.Consume(); err != nil {
+		return "", driverError(filter, err)
+	}
+
+	return header, nil
+}
+
+// countOptions returns the number of options of the given dimension using the given session.
+func (store *Store) countOptions(ctx context.Context, session neo4j.Session, filter *observation.Filter, dimension string) (int64, error) {
+	query := observation.NewCountOptionsQuery(filter.InstanceID, dimension)
+
+	result, err := session.Run(query.Statement, query.Parameters, store.txConfig(ctx)...)
+	if err != nil {
+		return 0, driverError(filter, err)
+	}
+
+	record, err := result.Single()
+	if err != nil {
+		return 0, driverError(filter, err)
+	}
+
+	if len(record.Values) == 0 {
+		return 0, newError(observation.ErrNoDataReturned, filter, nil)
+	}
+
+	count, ok := record.Values[0].(int64)
+	if !ok {
+		return 0, newError(observation.ErrUnrecognisedType, filter, nil)
+	}
+
+	return count, nil
+}
+
+// newSession opens a read session waiting for the bookmarks of the call.
+func (store *Store) newSession(ctx context.Context) neo4j.Session {
+	return store.driver.NewSession(neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeRead,
+		Bookmarks:    observation.BookmarksFromContext(ctx),
+		DatabaseName: store.database,
+		FetchSize:    store.fetchSize,
+	})
+}
+
+// txConfig returns the configuration of the transactions run for a call, which time out at the query
+// timeout of the store or the deadline of the context, whichever is sooner.
+func (store *Store) txConfig(ctx context.Context) []func(*neo4j.TransactionConfig) {
+	timeout := store.queryTimeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout <= 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+	}
+
+	if timeout <= 0 {
+		return nil
+	}
+
+	return []func(*neo4j.TransactionConfig){neo4j.WithTxTimeout(timeout)}
+}
+
+// log sends an event to the logger of the store, if it has one.
+func (store *Store) log(ctx context.Context, level observation.Level, event string, data map[string]interface{}) {
+	if store.logger != nil {
+		store.logger.Log(ctx, level, event, data, nil)
+	}
+}
+
+// newError returns a new error for the given filter.
+func newError(err error, filter *observation.Filter, cause error) *observation.Error {
+	return &observation.Error{
+		Err:        err,
+		InstanceID: filter.InstanceID,
+		FilterID:   filter.FilterID,
+		Cause:      cause,
+	}
+}
+
+// driverError returns the error for a failure of the driver, which is a timeout error if the transaction
+// timed out.
+func driverError(filter *observation.Filter, err error) *observation.Error {
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) && neo4jErr.Code == codeTransactionTimedOut {
+		return newError(observation.ErrTimeout, filter, err)
+	}
+
+	return newError(observation.ErrDriver, filter, err)
+}
+
+// contextError returns the error for a call whose context is done, or nil if it is not. As with the
+// observation store, a cancelled context is returned as is and an expired context as a timeout error.
+func contextError(ctx context.Context, filter *observation.Filter) error {
+	switch err := ctx.Err(); err {
+	case nil, context.Canceled:
+		return err
+	default:
+		return newError(observation.ErrTimeout, filter, err)
+	}
+}
@@ -0,0 +1,332 @@
+package neo4jstore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/neo4jstore"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var testContext = context.Background()
+
+const header = "V4_0,age_codelist,age"
+
+// fakeResult returns the given rows, followed by the given error.
+type fakeResult struct {
+	neo4j.Result
+	rows   []interface{}
+	err    error
+	record *neo4j.Record
+}
+
+func (result *fakeResult) Next() bool {
+	if len(result.rows) == 0 {
+		return false
+	}
+	result.record = &neo4j.Record{Values: []interface{}{result.rows[0]}, Keys: []string{"row"}}
+	result.rows = result.rows[1:]
+	return true
+}
+
+func (result *fakeResult) Record() *neo4j.Record {
+	return result.record
+}
+
+func (result *fakeResult) Single() (*neo4j.Record, error) {
+	if !result.Next() {
+		return nil, errors.New("no records")
+	}
+	return result.record, nil
+}
+
+func (result *fakeResult) Err() error {
+	return result.err
+}
+
+func (result *fakeResult) Consume() (neo4j.ResultSummary, error) {
+	result.rows = nil
+	return nil, nil
+}
+
+// fakeSession returns the header result for the first query run and the observation result for the next.
+type fakeSession struct {
+	neo4j.Session
+	results []*fakeResult
+	queries []string
+	closed  int
+}
+
+func (session *fakeSession) Run(cypher string, params map[string]interface{}, configurers ...func(*neo4j.TransactionConfig)) (neo4j.Result, error) {
+	session.queries = append(session.queries, cypher)
+	result := session.results[0]
+	session.results = session.results[1:]
+	if result == nil {
+		return nil, &neo4j.Neo4jError{Code: "Neo.ClientError.Transaction.TransactionTimedOut"}
+	}
+	return result, nil
+}
+
+func (session *fakeSession) Close() error {
+	session.closed++
+	return nil
+}
+
+type fakeDriver struct {
+	session *fakeSession
+	configs []neo4j.SessionConfig
+}
+
+func (driver *fakeDriver) NewSession(config neo4j.SessionConfig) neo4j.Session {
+	driver.configs = append(driver.configs, config)
+	return driver.session
+}
+
+func readAll(reader observation.CSVRowReader) ([]string, error) {
+	var rows []string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestStore_GetCSVRows(t *testing.T) {
+
+	Convey("Given a store with a driver returning the header and observations of an instance", t, func() {
+
+		filter := &observation.Filter{
+			InstanceID: "888",
+			DimensionFilters: []*observation.DimensionFilter{
+				{Name: "age", Options: []string{"29", "30"}},
+			},
+		}
+
+		session := &fakeSession{results: []*fakeResult{
+			{rows: []interface{}{header}},
+			{rows: []interface{}{"1,29,29", "2,30,30"}},
+		}}
+		driver := &fakeDriver{session: session}
+		store := neo4jstore.NewStore(driver, neo4jstore.WithDatabase("filters"))
+
+		Convey("When GetCSVRows is called with bookmarks and a limit", func() {
+
+			ctx := observation.ContextWithBookmarks(testContext, "bookmark:1")
+			limit := 10
+			reader, err := store.GetCSVRows(ctx, filter, &limit)
+
+			Convey("The same queries as the observation store are run in a read session", func() {
+				So(err, ShouldBeNil)
+				So(session.queries, ShouldResemble, []string{
+					observation.NewHeaderQuery("888").Statement,
+					observation.NewQuery(filter, &limit).Statement,
+				})
+				So(driver.configs[0].AccessMode, ShouldEqual, neo4j.AccessModeRead)
+				So(driver.configs[0].Bookmarks, ShouldResemble, []string{"bookmark:1"})
+				So(driver.configs[0].DatabaseName, ShouldEqual, "filters")
+			})
+
+			Convey("The header is read followed by the observations, and the session is closed", func() {
+				rows, err := readAll(reader)
+				So(err, ShouldBeNil)
+				So(rows, ShouldResemble, []string{header + "\n", "1,29,29\n", "2,30,30\n"})
+				So(session.closed, ShouldEqual, 1)
+
+				_, err = reader.Read()
+				So(err, ShouldEqual, io.EOF)
+			})
+
+			Convey("The session is closed once when the reader is closed", func() {
+				So(reader.Close(), ShouldBeNil)
+				So(reader.Close(), ShouldBeNil)
+				So(session.closed, ShouldEqual, 1)
+			})
+
+			Convey("Reading after the reader is closed returns ErrReaderClosed", func() {
+				So(reader.Close(), ShouldBeNil)
+				_, err := reader.Read()
+				So(err, ShouldEqual, observation.ErrReaderClosed)
+			})
+		})
+
+		Convey("When the filter selects no observations", func() {
+
+			session.results[1].rows = nil
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+			So(err, ShouldBeNil)
+
+			Convey("The header is read followed by an error matching ErrNoResultsFound", func() {
+				rows, err := readAll(reader)
+				So(rows, ShouldResemble, []string{header + "\n"})
+				So(errors.Is(err, observation.ErrNoResultsFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the instance does not exist", func() {
+
+			session.results[0].rows = nil
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("An error matching ErrNoInstanceFound is returned and the session is closed", func() {
+				So(reader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrNoInstanceFound), ShouldBeTrue)
+				So(len(session.queries), ShouldEqual, 1)
+				So(session.closed, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the observation query times out", func() {
+
+			session.results[1] = nil
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("An error matching ErrTimeout is returned and the session is closed", func() {
+				So(reader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrTimeout), ShouldBeTrue)
+				So(session.closed, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the observations cannot be read", func() {
+
+			session.results[1].err = errors.New("connection lost")
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+			So(err, ShouldBeNil)
+
+			Convey("An error matching ErrDriver is returned after the header, and by each later read", func() {
+				_, err := readAll(reader)
+				So(errors.Is(err, observation.ErrDriver), ShouldBeTrue)
+				So(session.closed, ShouldEqual, 1)
+
+				_, again := reader.Read()
+				So(again, ShouldEqual, err)
+			})
+		})
+
+		Convey("When GetCSVRows is called with a projection", func() {
+
+			filter.Projection = &observation.Projection{Include: []string{"age"}}
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+			So(err, ShouldBeNil)
+
+			Convey("Only the projected columns are read", func() {
+				rows, err := readAll(reader)
+				So(err, ShouldBeNil)
+				So(rows[1], ShouldEqual, "1,29,29\n")
+			})
+		})
+
+		Convey("When GetCSVRows is called with an invalid sort", func() {
+
+			filter.Sort = []*observation.SortDimension{{Name: ""}}
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The error is returned without opening a session", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrInvalidSort)
+				So(len(driver.configs), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestStore_GetCSVRowsLimits(t *testing.T) {
+
+	Convey("Given a store with limits and a driver returning the header and option count of an instance", t, func() {
+
+		session := &fakeSession{results: []*fakeResult{
+			{rows: []interface{}{header}},
+			{rows: []interface{}{int64(20)}},
+		}}
+		driver := &fakeDriver{session: session}
+		store := neo4jstore.NewStore(driver, neo4jstore.WithLimits(observation.Limits{
+			MaxOptionsPerDimension: 2,
+			MaxEstimatedRows:       10,
+		}))
+
+		Convey("When GetCSVRows is called with more options than the limit", func() {
+
+			filter := &observation.Filter{
+				InstanceID:       "888",
+				DimensionFilters: []*observation.DimensionFilter{{Name: "age", Options: []string{"29", "30", "31"}}},
+			}
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("An error matching ErrLimitExceeded is returned without opening a session", func() {
+				So(reader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrLimitExceeded), ShouldBeTrue)
+				So(len(driver.configs), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When GetCSVRows is called for an unfiltered dimension with more options than the estimated row limit", func() {
+
+			filter := &observation.Filter{InstanceID: "888"}
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("An error matching ErrLimitExceeded is returned without querying the observations", func() {
+				So(reader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrLimitExceeded), ShouldBeTrue)
+				So(session.queries, ShouldResemble, []string{
+					observation.NewHeaderQuery("888").Statement,
+					observation.NewCountOptionsQuery("888", "age").Statement,
+				})
+				So(session.closed, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetCSVRowsUnknownSort(t *testing.T) {
+
+	Convey("Given a store with a driver returning the header of an instance", t, func() {
+
+		session := &fakeSession{results: []*fakeResult{{rows: []interface{}{header}}}}
+		store := neo4jstore.NewStore(&fakeDriver{session: session})
+
+		Convey("When GetCSVRows is called sorting on a dimension that is not in the header", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				Sort:       []*observation.SortDimension{{Name: "time"}},
+			}
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("ErrUnknownDimension is returned without querying the observations", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(session.queries, ShouldResemble, []string{observation.NewHeaderQuery("888").Statement})
+				So(session.closed, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetHeader(t *testing.T) {
+
+	Convey("Given a store with a driver returning the header of an instance", t, func() {
+
+		session := &fakeSession{results: []*fakeResult{{rows: []interface{}{header}}}}
+		store := neo4jstore.NewStore(&fakeDriver{session: session})
+
+		Convey("When GetHeader is called", func() {
+
+			actual, err := store.GetHeader(testContext, "888")
+
+			Convey("The header is returned and the session is closed", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, header)
+				So(session.closed, ShouldEqual, 1)
+			})
+		})
+	})
+}
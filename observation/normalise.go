@@ -0,0 +1,94 @@
+package observation
+
+import "sort"
+
+// Normalisation reports the changes made to a filter by Normalise.
+type Normalisation struct {
+	RemovedDimensions int      // dimensions removed as they had no name or no options
+	RemovedOptions    int      // options removed as they were empty or duplicated
+	MergedDimensions  []string // names of dimensions that were specified more than once
+	Reordered         bool     // whether dimensions or options were reordered
+}
+
+// Changed returns true if normalising the filter changed it.
+func (n *Normalisation) Changed() bool {
+	return n.RemovedDimensions > 0 || n.RemovedOptions > 0 || len(n.MergedDimensions) > 0 || n.Reordered
+}
+
+// Normalise rewrites the dimension filters into a canonical form. Empty and duplicated options are removed,
+// dimensions with the same name are merged into one, dimensions without a name or options are removed, and
+// dimensions and options are sorted. The dimension filters are replaced rather than modified in place.
+func (f *Filter) Normalise() *Normalisation {
+	n := &Normalisation{}
+
+	var names []string
+	options := make(map[string][]string)
+	occurrences := make(map[string]int)
+
+	for _, dimension := range f.DimensionFilters {
+		if dimension == nil || dimension.Name == "" {
+			n.RemovedDimensions++
+			continue
+		}
+
+		if occurrences[dimension.Name] == 0 {
+			names = append(names, dimension.Name)
+		}
+		occurrences[dimension.Name]++
+		options[dimension.Name] = append(options[dimension.Name], dimension.Options...)
+	}
+
+	n.Reordered = !sort.StringsAreSorted(names)
+
+	var normalised []*DimensionFilter
+	for _, name := range names {
+		if occurrences[name] > 1 {
+			n.MergedDimensions = append(n.MergedDimensions, name)
+		}
+
+		unique := uniqueValues(options[name])
+		n.RemovedOptions += len(options[name]) - len(unique)
+
+		if len(unique) == 0 {
+			n.RemovedDimensions += occurrences[name]
+			continue
+		}
+
+		if !sort.StringsAreSorted(unique) {
+			n.Reordered = true
+			sort.Strings(unique)
+		}
+
+		normalised = append(normalised, &DimensionFilter{Name: name, Options: unique})
+	}
+
+	sort.Slice(normalised, func(i, j int) bool {
+		return normalised[i].Name < normalised[j].Name
+	})
+
+	f.DimensionFilters = normalised
+
+	return n
+}
+
+// uniqueValues returns the given values, in their original order, without any empty or duplicated values.
+func uniqueValues(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// sortedUnique returns a sorted copy of the given values without any empty or duplicated values.
+func sortedUnique(values []string) []string {
+	unique := uniqueValues(values)
+	sort.Strings(unique)
+	return unique
+}
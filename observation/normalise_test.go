@@ -0,0 +1,64 @@
+package observation_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFilter_Normalise(t *testing.T) {
+
+	Convey("Given a filter with empty, duplicated and unordered dimensions and options", t, func() {
+
+		filter := &observation.Filter{
+			InstanceID: "888",
+			DimensionFilters: []*observation.DimensionFilter{
+				{Name: "sex", Options: []string{"male", "female", "male"}},
+				{Name: "", Options: []string{"x"}},
+				{Name: "time", Options: []string{""}},
+				{Name: "age", Options: []string{"30"}},
+				{Name: "age", Options: []string{"29", "30"}},
+			},
+		}
+
+		Convey("When the filter is normalised", func() {
+
+			normalisation := filter.Normalise()
+
+			Convey("The dimensions are merged, cleaned and sorted", func() {
+				So(filter.DimensionFilters, ShouldResemble, []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"29", "30"}},
+					{Name: "sex", Options: []string{"female", "male"}},
+				})
+			})
+
+			Convey("The changes made are reported", func() {
+				So(normalisation.Changed(), ShouldBeTrue)
+				So(normalisation.RemovedDimensions, ShouldEqual, 2)
+				So(normalisation.RemovedOptions, ShouldEqual, 3)
+				So(normalisation.MergedDimensions, ShouldResemble, []string{"age"})
+				So(normalisation.Reordered, ShouldBeTrue)
+			})
+
+			Convey("Normalising the filter again makes no changes", func() {
+				So(filter.Normalise().Changed(), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a filter with no dimensions", t, func() {
+
+		filter := &observation.Filter{InstanceID: "888"}
+
+		Convey("When the filter is normalised", func() {
+
+			normalisation := filter.Normalise()
+
+			Convey("No changes are reported and the filter is still empty", func() {
+				So(normalisation.Changed(), ShouldBeFalse)
+				So(filter.IsEmpty(), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,39 @@
+// Package onslog adapts the ONSdigital/log.go event logger to the Logger interface of the observation
+// store, so that only services that use log.go depend on it.
+package onslog
+
+import (
+	"context"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/log.go/log"
+)
+
+// Check that the logger conforms to the observation Logger interface.
+var _ observation.Logger = Logger{}
+
+// Logger sends the log events of the store to log.Event.
+type Logger struct{}
+
+// New returns a logger sending the log events of the store to log.Event.
+func New() Logger {
+	return Logger{}
+}
+
+// Log sends the event to log.Event. Debug events are logged at INFO, as log.go has no lower severity.
+func (Logger) Log(ctx context.Context, level observation.Level, event string, data map[string]interface{}, err error) {
+	severity := log.INFO
+	switch {
+	case level >= observation.LevelError:
+		severity = log.ERROR
+	case level == observation.LevelWarn:
+		severity = log.WARN
+	}
+
+	if err != nil {
+		log.Event(ctx, event, severity, log.Data(data), log.Error(err))
+		return
+	}
+
+	log.Event(ctx, event, severity, log.Data(data))
+}
@@ -0,0 +1,425 @@
+package observation
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultPivotMemoryRows is the number of rows a pivot buffers in memory unless PivotConfig.MaxMemoryRows
+// is set.
+const defaultPivotMemoryRows = 100000
+
+// Check that the pivot row reader conforms to the CSVRowReader interface.
+var _ CSVRowReader = (*PivotRowReader)(nil)
+
+// PivotConfig configures how a pivot buffers the rows it reads.
+type PivotConfig struct {
+	MaxMemoryRows int    // the number of rows buffered in memory before they are spilled to disk
+	TempDir       string // the directory rows are spilled to, or empty for the default temporary directory
+}
+
+// PivotRowReader wraps a CSVRowReader, spreading the options of one dimension across columns to produce a
+// wide table. Each row holds the code list and label columns of the other dimensions, followed by the
+// observation of each option of the pivot dimension. If the instance has metadata columns, each option
+// also has a column for each of them. The options are ordered by code and named by label, and rows are
+// ordered by the codes and labels of the other dimensions. The first row read from the underlying reader
+// is expected to be the instance header. All of the underlying rows are read before the first row is
+// returned, and are spilled to disk if there are more than fit in memory.
+type PivotRowReader struct {
+	reader    CSVRowReader
+	dimension string
+	config    PivotConfig
+
+	keyColumns   []int             // the columns of the other dimensions
+	valueColumns int               // the number of observation and metadata columns
+	codeColumn   int               // the code column of the pivot dimension
+	labelColumn  int               // the label column of the pivot dimension
+	options      map[string]string // the label of each option of the pivot dimension, by code
+	codes        []string          // the codes of the options, in column order
+
+	buffer []*pivotRecord // the rows read since they were last spilled
+	runs   []string       // the files the rows have been spilled to, each sorted by key
+	merge  *pivotMerge
+	header string // the header row, until it has been read
+
+	started  bool
+	err      error // the error returned by Read once the rows have been read or have failed
+	closed   bool
+	closeErr error
+}
+
+// pivotRecord is a row of the underlying reader.
+type pivotRecord struct {
+	key    string   // the key fields joined, used to order and group the rows
+	fields []string // the code list and label fields of the other dimensions
+	code   string   // the code of the pivot option
+	values []string // the observation and metadata fields
+}
+
+// NewPivotRowReader returns a new row reader spreading the options of the given dimension across columns.
+func NewPivotRowReader(reader CSVRowReader, dimension string, config PivotConfig) *PivotRowReader {
+	if config.MaxMemoryRows <= 0 {
+		config.MaxMemoryRows = defaultPivotMemoryRows
+	}
+
+	return &PivotRowReader{
+		reader:    reader,
+		dimension: dimension,
+		config:    config,
+		options:   make(map[string]string),
+	}
+}
+
+// Read the next row of the wide table, or return io.EOF. The first row is the header of the table. The
+// reader is closed once io.EOF or an error is returned.
+func (reader *PivotRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	if reader.closed {
+		return "", ErrReaderClosed
+	}
+
+	if !reader.started {
+		reader.started = true
+		if err := reader.load(); err != nil {
+			reader.err = err
+			reader.Close()
+			return "", err
+		}
+	}
+
+	if reader.header != "" {
+		header := reader.header
+		reader.header = ""
+		return header, nil
+	}
+
+	row, err := reader.next()
+	if err != nil {
+		reader.err = err
+		reader.Close()
+		return "", err
+	}
+
+	return row, nil
+}
+
+// load reads all of the underlying rows, and prepares the header and the merge of the spilled rows.
+func (reader *PivotRowReader) load() error {
+	row, err := reader.reader.Read()
+	if err != nil {
+		return err
+	}
+
+	header, err := ParseHeader(row)
+	if err != nil {
+		return err
+	}
+
+	pivot := header.Dimension(reader.dimension)
+	if pivot == nil {
+		return ErrUnknownDimension
+	}
+
+	reader.codeColumn, reader.labelColumn = pivot.CodeListColumn, pivot.LabelColumn
+	reader.valueColumns = header.ObservationColumns()
+
+	var columns []string
+	for _, dimension := range header.Dimensions {
+		if dimension != pivot {
+			reader.keyColumns = append(reader.keyColumns, dimension.CodeListColumn, dimension.LabelColumn)
+			columns = append(columns, header.Columns[dimension.CodeListColumn], header.Columns[dimension.LabelColumn])
+		}
+	}
+
+	for {
+		row, err := reader.reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := reader.add(row, len(header.Columns)); err != nil {
+			return err
+		}
+	}
+
+	for code := range reader.options {
+		reader.codes = append(reader.codes, code)
+	}
+	sort.Strings(reader.codes)
+
+	metadata := header.Columns[1:reader.valueColumns]
+	for _, code := range reader.codes {
+		label := reader.options[code]
+		columns = append(columns, label)
+		for _, name := range metadata {
+			columns = append(columns, label+" "+name)
+		}
+	}
+
+	if reader.header, err = formatCSVRow(columns); err != nil {
+		return err
+	}
+
+	return reader.startMerge()
+}
+
+// add buffers a row of the underlying reader, spilling the buffer to disk once it is full.
+func (reader *PivotRowReader) add(row string, columns int) error {
+	fields, err := parseCSVRow(row)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) != columns {
+		return ErrInvalidHeader
+	}
+
+	record := &pivotRecord{
+		code:   fields[reader.codeColumn],
+		values: fields[:reader.valueColumns],
+	}
+	for _, column := range reader.keyColumns {
+		record.fields = append(record.fields, fields[column])
+	}
+	record.key = strings.Join(record.fields, "\x00")
+
+	reader.options[record.code] = fields[reader.labelColumn]
+	reader.buffer = append(reader.buffer, record)
+
+	if len(reader.buffer) >= reader.config.MaxMemoryRows {
+		return reader.spill()
+	}
+
+	return nil
+}
+
+// sortBuffer sorts the buffered rows by key.
+func (reader *PivotRowReader) sortBuffer() {
+	sort.SliceStable(reader.buffer, func(i, j int) bool {
+		return reader.buffer[i].key < reader.buffer[j].key
+	})
+}
+
+// spill writes the buffered rows to a new file, sorted by key, and empties the buffer.
+func (reader *PivotRowReader) spill() error {
+	reader.sortBuffer()
+
+	file, err := ioutil.TempFile(reader.config.TempDir, "pivot-*.csv")
+	if err != nil {
+		return err
+	}
+	reader.runs = append(reader.runs, file.Name())
+
+	writer := csv.NewWriter(file)
+	for _, record := range reader.buffer {
+		fields := append(append([]string{record.code}, record.fields...), record.values...)
+		if err := writer.Write(fields); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+
+	reader.buffer = nil
+	return file.Close()
+}
+
+// startMerge starts merging the buffered and spilled rows in order of key.
+func (reader *PivotRowReader) startMerge() error {
+	reader.sortBuffer()
+	reader.merge = &pivotMerge{}
+
+	// each source is added as soon as it is opened, so that Close closes it if a later one fails to open
+	reader.merge.sources = []pivotSource{&sliceSource{records: reader.buffer}}
+	for _, run := range reader.runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+
+		csvReader := csv.NewReader(file)
+		csvReader.FieldsPerRecord = 1 + len(reader.keyColumns) + reader.valueColumns
+		reader.merge.sources = append(reader.merge.sources, &fileSource{file: file, reader: csvReader, keyFields: len(reader.keyColumns)})
+	}
+
+	for _, source := range reader.merge.sources {
+		if err := reader.merge.advance(source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// next returns the wide row for the next key.
+func (reader *PivotRowReader) next() (string, error) {
+	if reader.merge.Len() == 0 {
+		return "", io.EOF
+	}
+
+	first := reader.merge.items[0].record
+	cells := make(map[string][]string)
+
+	for reader.merge.Len() > 0 && reader.merge.items[0].record.key == first.key {
+		item := reader.merge.items[0]
+		cells[item.record.code] = item.record.values
+		if err := reader.merge.advance(item.source); err != nil {
+			return "", err
+		}
+	}
+
+	fields := append([]string{}, first.fields...)
+	for _, code := range reader.codes {
+		values, ok := cells[code]
+		if !ok {
+			values = make([]string, reader.valueColumns)
+		}
+		fields = append(fields, values...)
+	}
+
+	return formatCSVRow(fields)
+}
+
+// Close the underlying reader and remove the spilled rows. Closing the reader more than once has no
+// further effect.
+func (reader *PivotRowReader) Close() error {
+	if reader.closed {
+		return reader.closeErr
+	}
+	reader.closed = true
+
+	errs := []error{reader.reader.Close()}
+	if reader.merge != nil {
+		for _, source := range reader.merge.sources {
+			errs = append(errs, source.close())
+		}
+	}
+	for _, run := range reader.runs {
+		errs = append(errs, os.Remove(run))
+	}
+
+	reader.closeErr = combineErrors(errs...)
+	return reader.closeErr
+}
+
+// pivotSource is a sorted run of rows.
+type pivotSource interface {
+	next() (*pivotRecord, error) // returns nil once all the rows have been read
+	close() error
+}
+
+type sliceSource struct {
+	records []*pivotRecord
+}
+
+func (source *sliceSource) next() (*pivotRecord, error) {
+	if len(source.records) == 0 {
+		return nil, nil
+	}
+
+	record := source.records[0]
+	source.records = source.records[1:]
+	return record, nil
+}
+
+func (source *sliceSource) close() error {
+	return nil
+}
+
+type fileSource struct {
+	file      *os.File
+	reader    *csv.Reader
+	keyFields int
+	closed    bool
+}
+
+func (source *fileSource) next() (*pivotRecord, error) {
+	fields, err := source.reader.Read()
+	if err == io.EOF {
+		return nil, source.close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := &pivotRecord{
+		code:   fields[0],
+		fields: fields[1 : 1+source.keyFields],
+		values: fields[1+source.keyFields:],
+	}
+	record.key = strings.Join(record.fields, "\x00")
+
+	return record, nil
+}
+
+func (source *fileSource) close() error {
+	if source.closed {
+		return nil
+	}
+	source.closed = true
+
+	return source.file.Close()
+}
+
+// pivotMerge is a heap of the next row of each source, ordered by key.
+type pivotMerge struct {
+	items   []*pivotItem
+	sources []pivotSource
+}
+
+type pivotItem struct {
+	record *pivotRecord
+	source pivotSource
+}
+
+// advance replaces the current row of the source with its next row, if it has one.
+func (merge *pivotMerge) advance(source pivotSource) error {
+	for i, item := range merge.items {
+		if item.source == source {
+			heap.Remove(merge, i)
+			break
+		}
+	}
+
+	record, err := source.next()
+	if err != nil || record == nil {
+		return err
+	}
+
+	heap.Push(merge, &pivotItem{record: record, source: source})
+	return nil
+}
+
+func (merge *pivotMerge) Len() int { return len(merge.items) }
+
+func (merge *pivotMerge) Less(i, j int) bool {
+	return merge.items[i].record.key < merge.items[j].record.key
+}
+
+func (merge *pivotMerge) Swap(i, j int) {
+	merge.items[i], merge.items[j] = merge.items[j], merge.items[i]
+}
+
+func (merge *pivotMerge) Push(x interface{}) { merge.items = append(merge.items, x.(*pivotItem)) }
+
+func (merge *pivotMerge) Pop() interface{} {
+	item := merge.items[len(merge.items)-1]
+	merge.items = merge.items[:len(merge.items)-1]
+	return item
+}
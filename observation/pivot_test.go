@@ -0,0 +1,127 @@
+package observation_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPivotRowReader_Read(t *testing.T) {
+
+	Convey("Given a row reader returning a header and unsorted observations with three dimensions", t, func() {
+
+		rows := []string{
+			"V4_1,Data_Marking,calendar-years,Time,uk-only,Geography,sex,Sex\n",
+			"1,,2018,2018,K02000001,United Kingdom,male,Male\n",
+			"2,,2017,2017,K02000001,United Kingdom,male,Male\n",
+			"3,x,2017,2017,K02000001,United Kingdom,female,Female\n",
+			"4,,2018,2018,E92000001,England,male,Male\n",
+		}
+
+		Convey("When the rows are pivoted on a dimension", func() {
+
+			underlying := newMockRowReader(rows...)
+			reader := observation.NewPivotRowReader(underlying, "time", observation.PivotConfig{})
+			pivoted, err := readAllRows(reader)
+
+			Convey("The options of the dimension are spread across columns, leaving missing observations empty", func() {
+				So(err, ShouldBeNil)
+				So(pivoted, ShouldResemble, []string{
+					"uk-only,Geography,sex,Sex,2017,2017 Data_Marking,2018,2018 Data_Marking\n",
+					"E92000001,England,male,Male,,,4,\n",
+					"K02000001,United Kingdom,female,Female,3,x,,\n",
+					"K02000001,United Kingdom,male,Male,2,,1,\n",
+				})
+			})
+
+			Convey("The underlying reader is closed", func() {
+				So(len(underlying.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the rows are pivoted with less memory than there are rows", func() {
+
+			dir, err := ioutil.TempDir("", "pivot")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			inMemory, err := readAllRows(observation.NewPivotRowReader(newMockRowReader(rows...), "time", observation.PivotConfig{}))
+			So(err, ShouldBeNil)
+
+			reader := observation.NewPivotRowReader(newMockRowReader(rows...), "time", observation.PivotConfig{
+				MaxMemoryRows: 1,
+				TempDir:       dir,
+			})
+			pivoted, err := readAllRows(reader)
+
+			Convey("The rows are the same as when they are pivoted in memory", func() {
+				So(err, ShouldBeNil)
+				So(pivoted, ShouldResemble, inMemory)
+			})
+
+			Convey("The rows spilled to disk are removed", func() {
+				files, err := ioutil.ReadDir(dir)
+				So(err, ShouldBeNil)
+				So(files, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the rows are pivoted on a dimension that is not in the header", func() {
+
+			underlying := newMockRowReader(rows...)
+			reader := observation.NewPivotRowReader(underlying, "age", observation.PivotConfig{})
+			_, err := reader.Read()
+
+			Convey("ErrUnknownDimension is returned and the underlying reader is closed", func() {
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(len(underlying.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestPivotRowReader_Close(t *testing.T) {
+
+	Convey("Given a pivot row reader that has spilled rows to disk", t, func() {
+
+		dir, err := ioutil.TempDir("", "pivot")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		underlying := newMockRowReader(
+			"V4_0,time,time,geography,geography\n",
+			"1,2017,2017,K02000001,United Kingdom\n",
+			"2,2018,2018,K02000001,United Kingdom\n",
+		)
+		reader := observation.NewPivotRowReader(underlying, "time", observation.PivotConfig{
+			MaxMemoryRows: 1,
+			TempDir:       dir,
+		})
+
+		header, err := reader.Read()
+		So(err, ShouldBeNil)
+		So(header, ShouldEqual, "geography,geography,2017,2018\n")
+
+		Convey("When the reader is closed twice", func() {
+
+			So(reader.Close(), ShouldBeNil)
+			So(reader.Close(), ShouldBeNil)
+
+			Convey("The underlying reader is closed once and the spilled rows are removed", func() {
+				So(len(underlying.CloseCalls()), ShouldEqual, 1)
+
+				files, err := ioutil.ReadDir(dir)
+				So(err, ShouldBeNil)
+				So(files, ShouldBeEmpty)
+			})
+
+			Convey("Reading returns ErrReaderClosed", func() {
+				_, err := reader.Read()
+				So(err, ShouldEqual, observation.ErrReaderClosed)
+			})
+		})
+	})
+}
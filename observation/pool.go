@@ -0,0 +1,284 @@
+package observation
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// ErrPoolExhausted is returned by a tracked pool if no connection is released within its maximum wait.
+var ErrPoolExhausted = errors.New("no database connection was released within the maximum wait")
+
+// Check that the tracked pool conforms to the pool interfaces.
+var (
+	_ DBPool     = (*TrackedPool)(nil)
+	_ ReadDBPool = (*TrackedPool)(nil)
+)
+
+// PoolConfig configures a tracked pool.
+type PoolConfig struct {
+	MaxInUse int           // the maximum number of connections leased at once, or zero for no limit
+	MaxWait  time.Duration // how long to wait for a connection to be released once MaxInUse are leased, or zero to wait indefinitely
+	Logger   Logger        // receives an event for each connection that is garbage collected without being closed
+}
+
+// PoolStats describes the connections leased from a tracked pool.
+type PoolStats struct {
+	InUse       int           // the number of connections currently leased
+	Available   int           // the number of connections that can be leased without waiting, or -1 if leases are not limited
+	PeakInUse   int           // the highest number of connections leased at once
+	Leases      int64         // the number of connections leased
+	Errors      int64         // the number of connections the wrapped pool failed to open
+	Waits       int64         // the number of leases that waited for another connection to be released
+	TotalWait   time.Duration // the time spent opening connections, including waiting for them to be released
+	MaxWait     time.Duration // the longest time spent opening a connection
+	MaxLease    time.Duration // the longest time a connection has been leased for, including current leases
+	Leaked      int64         // the number of connections garbage collected without being closed
+	OldestLease time.Time     // when the longest current lease started, or the zero time if there are none
+}
+
+// TrackedPool wraps a DBPool, limiting the number of connections leased at once and recording statistics
+// of the leases. Connections that are garbage collected without being closed, e.g. by a row reader that was
+// never closed, are logged and counted, and are then closed on another goroutine.
+type TrackedPool struct {
+	pool   DBPool
+	config PoolConfig
+	slots  chan struct{} // holds a value for each leased connection, if the number of leases is limited
+
+	mutex  sync.Mutex
+	stats  PoolStats
+	nextID uint64
+	leases map[uint64]time.Time // the start of each current lease, by lease ID
+}
+
+// NewTrackedPool returns a tracked pool wrapping the given pool.
+func NewTrackedPool(pool DBPool, config PoolConfig) *TrackedPool {
+	tracked := &TrackedPool{
+		pool:   pool,
+		config: config,
+		leases: make(map[uint64]time.Time),
+	}
+
+	if config.MaxInUse > 0 {
+		tracked.slots = make(chan struct{}, config.MaxInUse)
+	}
+
+	return tracked
+}
+
+// OpenPool leases a connection from the wrapped pool, waiting for a connection to be released if the
+// maximum number are leased.
+func (pool *TrackedPool) OpenPool() (bolt.Conn, error) {
+	return pool.open(pool.pool.OpenPool)
+}
+
+// OpenReadPool leases a connection for reads from the wrapped pool, if it can route connections for reads,
+// or otherwise from its OpenPool.
+func (pool *TrackedPool) OpenReadPool() (bolt.Conn, error) {
+	if readPool, ok := pool.pool.(ReadDBPool); ok {
+		return pool.open(readPool.OpenReadPool)
+	}
+
+	return pool.OpenPool()
+}
+
+// Stats returns the statistics of the connections leased from the pool.
+func (pool *TrackedPool) Stats() PoolStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	stats := pool.stats
+
+	// the idle connections of the wrapped pool cannot be seen, so only the remaining leases are reported
+	stats.Available = -1
+	if pool.config.MaxInUse > 0 {
+		stats.Available = pool.config.MaxInUse - stats.InUse
+	}
+
+	now := time.Now()
+	for _, leased := range pool.leases {
+		if lease := now.Sub(leased); lease > stats.MaxLease {
+			stats.MaxLease = lease
+		}
+		if stats.OldestLease.IsZero() || leased.Before(stats.OldestLease) {
+			stats.OldestLease = leased
+		}
+	}
+
+	return stats
+}
+
+func (pool *TrackedPool) open(open func() (bolt.Conn, error)) (bolt.Conn, error) {
+	start := time.Now()
+
+	if err := pool.acquireSlot(); err != nil {
+		pool.recordOpen(start, err)
+		return nil, err
+	}
+
+	conn, err := open()
+	if err != nil {
+		pool.releaseSlot()
+		pool.recordOpen(start, err)
+		return nil, err
+	}
+
+	tracked := &trackedConn{
+		Conn:   conn,
+		pool:   pool,
+		leased: time.Now(),
+	}
+
+	pool.mutex.Lock()
+	pool.nextID++
+	tracked.id = pool.nextID
+	pool.leases[tracked.id] = tracked.leased
+	pool.mutex.Unlock()
+	pool.recordOpen(start, nil)
+
+	// the pool does not keep a reference to the connection, so it is found by the garbage collector if the
+	// caller drops it without closing it
+	runtime.SetFinalizer(tracked, func(tracked *trackedConn) {
+		tracked.leaked(tracked)
+	})
+
+	return tracked, nil
+}
+
+// acquireSlot waits for a lease to be available, within the maximum wait.
+func (pool *TrackedPool) acquireSlot() error {
+	if pool.slots == nil {
+		return nil
+	}
+
+	select {
+	case pool.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	pool.mutex.Lock()
+	pool.stats.Waits++
+	pool.mutex.Unlock()
+
+	if pool.config.MaxWait <= 0 {
+		pool.slots <- struct{}{}
+		return nil
+	}
+
+	timer := time.NewTimer(pool.config.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case pool.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrPoolExhausted
+	}
+}
+
+func (pool *TrackedPool) releaseSlot() {
+	if pool.slots != nil {
+		<-pool.slots
+	}
+}
+
+// recordOpen records the time taken to open a connection and whether it was leased.
+func (pool *TrackedPool) recordOpen(start time.Time, err error) {
+	wait := time.Since(start)
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.stats.TotalWait += wait
+	if wait > pool.stats.MaxWait {
+		pool.stats.MaxWait = wait
+	}
+
+	if err != nil {
+		pool.stats.Errors++
+		return
+	}
+
+	pool.stats.Leases++
+	pool.stats.InUse++
+	if pool.stats.InUse > pool.stats.PeakInUse {
+		pool.stats.PeakInUse = pool.stats.InUse
+	}
+}
+
+// release ends the lease of a connection.
+func (pool *TrackedPool) release(conn *trackedConn) {
+	lease := time.Since(conn.leased)
+
+	pool.mutex.Lock()
+	delete(pool.leases, conn.id)
+	pool.stats.InUse--
+	if lease > pool.stats.MaxLease {
+		pool.stats.MaxLease = lease
+	}
+	pool.mutex.Unlock()
+
+	pool.releaseSlot()
+}
+
+// trackedConn is a connection leased from a tracked pool, which ends the lease when it is closed.
+type trackedConn struct {
+	bolt.Conn
+	pool   *TrackedPool
+	id     uint64
+	leased time.Time
+	once   sync.Once
+}
+
+// Close releases the connection back into the wrapped pool. Closing it more than once has no further effect.
+func (conn *trackedConn) Close() error {
+	var err error
+	conn.once.Do(func() {
+		runtime.SetFinalizer(conn, nil)
+		err = conn.Conn.Close()
+		conn.pool.release(conn)
+	})
+
+	return err
+}
+
+// leaked is called by the garbage collector if the connection is no longer used but was not closed. The
+// leak is only counted and logged by the finalizer, and the connection is closed through the given closer
+// on another goroutine, as closing it may discard the rest of a result stream over the network.
+func (conn *trackedConn) leaked(closer io.Closer) {
+	lease := time.Since(conn.leased)
+
+	pool := conn.pool
+	pool.mutex.Lock()
+	pool.stats.Leaked++
+	pool.mutex.Unlock()
+
+	if logger := pool.config.Logger; logger != nil {
+		logger.Log(context.Background(), LevelWarn, "database connection garbage collected without being closed", map[string]interface{}{
+			"leasedAt":      conn.leased,
+			"leaseDuration": lease.String(),
+		}, nil)
+	}
+
+	go closer.Close()
+}
+
+// closeLeaked moves the leak tracking of a connection leased from a tracked pool onto the wrapper returned
+// for it, so that a leaked connection is closed through the wrapper, e.g. rolling back its transaction.
+func closeLeaked(leased, wrapper bolt.Conn) {
+	tracked, ok := leased.(*trackedConn)
+	if !ok || wrapper == leased {
+		return
+	}
+
+	runtime.SetFinalizer(tracked, nil)
+	runtime.SetFinalizer(wrapper, func(wrapper bolt.Conn) {
+		tracked.leaked(wrapper)
+	})
+}
@@ -0,0 +1,220 @@
+package observation_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newPoolConnection() *observationtest.ConnMock {
+	return &observationtest.ConnMock{
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+func TestTrackedPool(t *testing.T) {
+
+	Convey("Given a tracked pool wrapping a mock pool", t, func() {
+
+		var conns []*observationtest.ConnMock
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				conn := newPoolConnection()
+				conns = append(conns, conn)
+				return conn, nil
+			},
+		}
+
+		mockedLogger := &observationtest.LoggerMock{
+			LogFunc: func(ctx context.Context, level observation.Level, event string, data map[string]interface{}, err error) {
+			},
+		}
+
+		pool := observation.NewTrackedPool(mockedPool, observation.PoolConfig{
+			MaxInUse: 2,
+			MaxWait:  10 * time.Millisecond,
+			Logger:   mockedLogger,
+		})
+
+		Convey("When connections are leased and closed", func() {
+
+			first, err := pool.OpenPool()
+			So(err, ShouldBeNil)
+			second, err := pool.OpenPool()
+			So(err, ShouldBeNil)
+
+			inUse := pool.Stats()
+
+			So(first.Close(), ShouldBeNil)
+			So(first.Close(), ShouldBeNil)
+
+			Convey("The leases are counted", func() {
+				So(inUse.InUse, ShouldEqual, 2)
+				So(inUse.Available, ShouldEqual, 0)
+				So(inUse.OldestLease.IsZero(), ShouldBeFalse)
+
+				stats := pool.Stats()
+				So(stats.Leases, ShouldEqual, 2)
+				So(stats.InUse, ShouldEqual, 1)
+				So(stats.Available, ShouldEqual, 1)
+				So(stats.PeakInUse, ShouldEqual, 2)
+				So(stats.MaxLease, ShouldBeGreaterThan, 0)
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 2)
+			})
+
+			Convey("The wrapped connection is only closed once", func() {
+				So(len(conns[0].CloseCalls()), ShouldEqual, 1)
+			})
+
+			second.Close()
+		})
+
+		Convey("When more connections are leased than the maximum", func() {
+
+			first, _ := pool.OpenPool()
+			second, _ := pool.OpenPool()
+			conn, err := pool.OpenPool()
+
+			Convey("ErrPoolExhausted is returned once the maximum wait is reached", func() {
+				So(conn, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrPoolExhausted)
+				stats := pool.Stats()
+				So(stats.Waits, ShouldEqual, 1)
+				So(stats.Errors, ShouldEqual, 1)
+				So(stats.MaxWait, ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+				So(len(mockedPool.OpenPoolCalls()), ShouldEqual, 2)
+			})
+
+			first.Close()
+			second.Close()
+		})
+
+		Convey("When a connection is released while waiting for a lease", func() {
+
+			pool := observation.NewTrackedPool(mockedPool, observation.PoolConfig{MaxInUse: 1})
+			held, _ := pool.OpenPool()
+			go func() {
+				time.Sleep(time.Millisecond)
+				held.Close()
+			}()
+			conn, err := pool.OpenPool()
+
+			Convey("The released connection is leased", func() {
+				So(err, ShouldBeNil)
+				So(conn, ShouldNotBeNil)
+				So(pool.Stats().Waits, ShouldEqual, 1)
+				So(pool.Stats().InUse, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a connection is leased from a pool without a lease limit", func() {
+
+			pool := observation.NewTrackedPool(mockedPool, observation.PoolConfig{})
+			conn, err := pool.OpenPool()
+			So(err, ShouldBeNil)
+
+			Convey("The available leases are reported as unlimited", func() {
+				So(pool.Stats().Available, ShouldEqual, -1)
+			})
+
+			conn.Close()
+		})
+
+		Convey("When the wrapped pool fails to open a connection", func() {
+
+			mockedPool.OpenPoolFunc = func() (bolt.Conn, error) {
+				return nil, errors.New("broken")
+			}
+			_, err := pool.OpenPool()
+
+			Convey("The error is returned and the lease is not counted", func() {
+				So(err, ShouldNotBeNil)
+				stats := pool.Stats()
+				So(stats.Errors, ShouldEqual, 1)
+				So(stats.InUse, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a connection is garbage collected without being closed", func() {
+
+			leak := func() {
+				_, err := pool.OpenPool()
+				So(err, ShouldBeNil)
+			}
+			leak()
+
+			for i := 0; i < 100 && pool.Stats().InUse > 0; i++ {
+				runtime.GC()
+				time.Sleep(time.Millisecond)
+			}
+
+			Convey("The leak is counted and logged, and the connection is released", func() {
+				stats := pool.Stats()
+				So(stats.Leaked, ShouldEqual, 1)
+				So(stats.InUse, ShouldEqual, 0)
+				So(len(mockedLogger.LogCalls()), ShouldEqual, 1)
+				So(mockedLogger.LogCalls()[0].Level, ShouldEqual, observation.LevelWarn)
+				So(len(conns[0].CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_LeakedConnection(t *testing.T) {
+
+	Convey("Given a store using read transactions on a tracked pool", t, func() {
+
+		conn := newHeaderConnection()
+		conn.QueryNeoFunc = func(query string, params map[string]interface{}) (bolt.Rows, error) {
+			return &observationtest.BoltRowsMock{
+				NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+					return []interface{}{"1,,30,30,male,Male"}, nil, nil
+				},
+				CloseFunc: func() error {
+					return nil
+				},
+			}, nil
+		}
+
+		pool := observation.NewTrackedPool(&observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return conn, nil
+			},
+		}, observation.PoolConfig{})
+
+		store := observation.NewStore(pool, observation.WithReadTransactions())
+
+		Convey("When a row reader is garbage collected without being closed", func() {
+
+			leak := func() {
+				_, err := store.GetCSVRows(testContext, &observation.Filter{InstanceID: "888"}, nil)
+				So(err, ShouldBeNil)
+			}
+			leak()
+
+			for i := 0; i < 100 && pool.Stats().InUse > 0; i++ {
+				runtime.GC()
+				time.Sleep(time.Millisecond)
+			}
+
+			Convey("The leak is counted and the read transaction is rolled back before the connection is closed", func() {
+				stats := pool.Stats()
+				So(stats.Leaked, ShouldEqual, 1)
+				So(stats.InUse, ShouldEqual, 0)
+
+				execCalls := conn.ExecNeoCalls()
+				So(execCalls[len(execCalls)-1].Query, ShouldEqual, "ROLLBACK")
+				So(len(conn.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
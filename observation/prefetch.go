@@ -0,0 +1,143 @@
+package observation
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrReaderClosed is returned if a row is read after the reader has been closed.
+var ErrReaderClosed = errors.New("the row reader has been closed")
+
+// Check that the prefetch row reader conforms to the CSVRowReader interface.
+var _ CSVRowReader = (*PrefetchRowReader)(nil)
+
+// WithPrefetch returns an option that reads rows from the database in a background goroutine, holding up to
+// size rows ahead of the reader, so that waiting on the database overlaps with processing the rows. The
+// goroutine runs until the reader is closed or the context of the call is done.
+func WithPrefetch(size int) Option {
+	return func(store *Store) {
+		store.prefetch = size
+	}
+}
+
+// PrefetchRowReader wraps a CSVRowReader, reading its rows in a background goroutine into a bounded buffer.
+// The goroutine stops once the reader is closed or the context of the call is done, so a reader that is
+// neither must not be dropped: its goroutine would wait on the full buffer, holding the underlying reader
+// and its connection, forever.
+type PrefetchRowReader struct {
+	ctx       context.Context
+	reader    CSVRowReader
+	rows      chan prefetchedRow
+	done      chan struct{} // closed to stop the background goroutine
+	stopped   chan struct{} // closed once the background goroutine has closed the underlying reader and returned
+	closeOnce sync.Once
+	closeErr  error // the error closing the underlying reader, set before stopped is closed
+	err       error // the error that ended the rows, returned by each read once reached
+}
+
+type prefetchedRow struct {
+	row string
+	err error
+}
+
+// NewPrefetchRowReader returns a new row reader that reads up to size rows ahead of the caller from the
+// given reader, until the reader is closed or the context is done. The given reader is only used by the
+// background goroutine, which closes it once it stops.
+func NewPrefetchRowReader(ctx context.Context, reader CSVRowReader, size int) *PrefetchRowReader {
+	prefetch := &PrefetchRowReader{
+		ctx:     ctx,
+		reader:  reader,
+		rows:    make(chan prefetchedRow, size),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go prefetch.run()
+
+	return prefetch
+}
+
+// run reads rows from the underlying reader until it returns an error, including io.EOF, the reader is
+// closed or the context is done, and then closes the underlying reader to release its connection.
+func (reader *PrefetchRowReader) run() {
+	defer close(reader.stopped)
+	defer func() {
+		reader.closeErr = reader.reader.Close()
+	}()
+
+	for {
+		row, err := reader.reader.Read()
+
+		select {
+		case reader.rows <- prefetchedRow{row: row, err: err}:
+		case <-reader.done:
+			return
+		case <-reader.ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read the next prefetched row, waiting for it to be read if necessary, or return io.EOF. Once the context
+// is done the error of the context is returned after the rows already prefetched.
+func (reader *PrefetchRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	select {
+	case <-reader.done:
+		return "", ErrReaderClosed
+	default:
+	}
+
+	select {
+	case prefetched := <-reader.rows:
+		return reader.prefetched(prefetched)
+	case <-reader.done:
+		return "", ErrReaderClosed
+	case <-reader.stopped:
+	}
+
+	// the background goroutine has stopped, so no more rows will be sent
+	select {
+	case prefetched := <-reader.rows:
+		return reader.prefetched(prefetched)
+	default:
+		reader.err = reader.ctx.Err()
+		return "", reader.err
+	}
+}
+
+func (reader *PrefetchRowReader) prefetched(prefetched prefetchedRow) (string, error) {
+	reader.err = prefetched.err
+	return prefetched.row, prefetched.err
+}
+
+// Close stops prefetching rows and waits for the underlying reader to be closed. If a row is being read
+// from the underlying reader then it is only closed once the row is returned, so the underlying reader is
+// never used concurrently. Close stops waiting for it once the context is done, returning the error of the
+// context, and the underlying reader is then closed in the background.
+func (reader *PrefetchRowReader) Close() error {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+
+	select {
+	case <-reader.stopped:
+		return reader.closeErr
+	case <-reader.ctx.Done():
+	}
+
+	select {
+	case <-reader.stopped:
+		return reader.closeErr
+	default:
+		return reader.ctx.Err()
+	}
+}
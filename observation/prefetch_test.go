@@ -0,0 +1,166 @@
+package observation_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrefetchRowReader_Read(t *testing.T) {
+
+	Convey("Given a prefetch row reader wrapping a mock row reader with several rows", t, func() {
+
+		rows := []string{"V4_0,time_codelist,time\n", "1,2017,2017\n", "2,2018,2018\n"}
+		mockRowReader := newMockRowReader(rows...)
+
+		reader := observation.NewPrefetchRowReader(testContext, mockRowReader, 2)
+
+		Convey("When the rows are read to the end", func() {
+
+			actual, err := readAllRows(reader)
+			_, errAfterEOF := reader.Read()
+
+			Convey("The rows are returned in order, followed by io.EOF on each read", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, rows)
+				So(errAfterEOF, ShouldEqual, io.EOF)
+			})
+
+			Convey("And the reader is closed twice, the underlying reader is closed once", func() {
+				So(reader.Close(), ShouldBeNil)
+				So(reader.Close(), ShouldBeNil)
+				So(len(mockRowReader.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a prefetch row reader wrapping a mock row reader that returns an error", t, func() {
+
+		expectedErr := errors.New("broken")
+
+		mockRowReader := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				return "", expectedErr
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		reader := observation.NewPrefetchRowReader(testContext, mockRowReader, 2)
+
+		Convey("When read is called twice", func() {
+
+			_, err1 := reader.Read()
+			_, err2 := reader.Read()
+
+			Convey("The error is returned each time and the underlying reader is not read again", func() {
+				So(err1, ShouldEqual, expectedErr)
+				So(err2, ShouldEqual, expectedErr)
+				So(len(mockRowReader.ReadCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a prefetch row reader wrapping a mock row reader with endless rows", t, func() {
+
+		mockRowReader := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				return "1,2017,2017\n", nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		reader := observation.NewPrefetchRowReader(testContext, mockRowReader, 1)
+
+		Convey("When the reader is closed while the buffer is full", func() {
+
+			row, err := reader.Read()
+			time.Sleep(10 * time.Millisecond)
+			closeErr := reader.Close()
+			reads := len(mockRowReader.ReadCalls())
+
+			_, errAfterClose := reader.Read()
+
+			Convey("Prefetching stops and the underlying reader is closed", func() {
+				So(err, ShouldBeNil)
+				So(row, ShouldEqual, "1,2017,2017\n")
+				So(closeErr, ShouldBeNil)
+				So(len(mockRowReader.CloseCalls()), ShouldEqual, 1)
+				So(len(mockRowReader.ReadCalls()), ShouldEqual, reads)
+				So(errAfterClose, ShouldEqual, observation.ErrReaderClosed)
+			})
+		})
+	})
+
+	Convey("Given a prefetch row reader wrapping a mock row reader with endless rows, for a context that is cancelled", t, func() {
+
+		mockRowReader := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				return "1,2017,2017\n", nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		ctx, cancel := context.WithCancel(testContext)
+		reader := observation.NewPrefetchRowReader(ctx, mockRowReader, 1)
+
+		Convey("When the context is cancelled while the buffer is full and the reader is not closed", func() {
+
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+			for i := 0; i < 100 && len(mockRowReader.CloseCalls()) == 0; i++ {
+				time.Sleep(time.Millisecond)
+			}
+
+			row, err := reader.Read()
+			_, errAfterCancel := reader.Read()
+
+			Convey("Prefetching stops, the underlying reader is closed and the prefetched row is returned before the error of the context", func() {
+				So(len(mockRowReader.CloseCalls()), ShouldEqual, 1)
+				So(err, ShouldBeNil)
+				So(row, ShouldEqual, "1,2017,2017\n")
+				So(errAfterCancel, ShouldEqual, context.Canceled)
+			})
+		})
+	})
+
+	Convey("Given a prefetch row reader wrapping a mock row reader whose read does not return", t, func() {
+
+		blocked := make(chan struct{})
+		defer close(blocked)
+
+		mockRowReader := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				<-blocked
+				return "", io.EOF
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		ctx, cancel := context.WithTimeout(testContext, 10*time.Millisecond)
+		defer cancel()
+		reader := observation.NewPrefetchRowReader(ctx, mockRowReader, 1)
+
+		Convey("When the reader is closed", func() {
+
+			closeErr := reader.Close()
+
+			Convey("Close stops waiting for the read once the context is done, and returns the error of the context", func() {
+				So(errors.Is(closeErr, context.DeadlineExceeded), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package observation
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrInvalidProjection is returned if a projection specifies both included and excluded dimensions.
+var ErrInvalidProjection = errors.New("a projection cannot both include and exclude dimensions")
+
+// Check that the projection row reader conforms to the CSVRowReader interface.
+var _ CSVRowReader = (*ProjectionRowReader)(nil)
+
+// ProjectionRowReader wraps a CSVRowReader, removing the dimension columns that are not selected by a
+// projection. The first row read from the underlying reader is expected to be the instance header.
+type ProjectionRowReader struct {
+	reader     CSVRowReader
+	projection *Projection
+	columns    []int // the indexes of the columns to write, set once the header has been read
+}
+
+// NewProjectionRowReader returns a new row reader applying the given projection to the rows of the given reader.
+func NewProjectionRowReader(reader CSVRowReader, projection *Projection) *ProjectionRowReader {
+	return &ProjectionRowReader{
+		reader:     reader,
+		projection: projection,
+	}
+}
+
+// Validate checks that the projection is well formed.
+func (projection *Projection) Validate() error {
+	if len(projection.Include) > 0 && len(projection.Exclude) > 0 {
+		return ErrInvalidProjection
+	}
+
+	return nil
+}
+
+// Read the next row with the unselected dimension columns removed, or return io.EOF
+func (reader *ProjectionRowReader) Read() (string, error) {
+	row, err := reader.reader.Read()
+	if err != nil && (err != io.EOF || len(row) == 0) {
+		return "", err
+	}
+
+	if reader.columns == nil {
+		header, headerErr := ParseHeader(row)
+		if headerErr != nil {
+			return "", headerErr
+		}
+
+		reader.columns, headerErr = reader.projection.columns(header)
+		if headerErr != nil {
+			return "", headerErr
+		}
+	}
+
+	fields, parseErr := parseCSVRow(row)
+	if parseErr != nil {
+		return "", parseErr
+	}
+
+	projected := make([]string, 0, len(reader.columns))
+	for _, column := range reader.columns {
+		if column < len(fields) {
+			projected = append(projected, fields[column])
+		}
+	}
+
+	projectedRow, formatErr := formatCSVRow(projected)
+	if formatErr != nil {
+		return "", formatErr
+	}
+
+	return projectedRow, err
+}
+
+// Close the underlying reader.
+func (reader *ProjectionRowReader) Close() error {
+	return reader.reader.Close()
+}
+
+// columns returns the indexes of the header columns selected by the projection.
+func (projection *Projection) columns(header *Header) ([]int, error) {
+	if err := projection.Validate(); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[*HeaderDimension]bool, len(header.Dimensions))
+	for _, dimension := range header.Dimensions {
+		selected[dimension] = len(projection.Include) == 0
+	}
+
+	for _, name := range projection.Include {
+		dimension := header.Dimension(name)
+		if dimension == nil {
+			return nil, ErrUnknownDimension
+		}
+		selected[dimension] = true
+	}
+
+	for _, name := range projection.Exclude {
+		dimension := header.Dimension(name)
+		if dimension == nil {
+			return nil, ErrUnknownDimension
+		}
+		selected[dimension] = false
+	}
+
+	var columns []int
+	for i := 0; i < header.ObservationColumns(); i++ {
+		columns = append(columns, i)
+	}
+
+	for _, dimension := range header.Dimensions {
+		if selected[dimension] {
+			columns = append(columns, dimension.CodeListColumn, dimension.LabelColumn)
+		}
+	}
+
+	return columns, nil
+}
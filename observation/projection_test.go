@@ -0,0 +1,122 @@
+package observation_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newMockRowReader(rows ...string) *observationtest.CSVRowReaderMock {
+	return &observationtest.CSVRowReaderMock{
+		ReadFunc: func() (string, error) {
+			if len(rows) == 0 {
+				return "", io.EOF
+			}
+			row := rows[0]
+			rows = rows[1:]
+			return row, nil
+		},
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+func readAllRows(reader observation.CSVRowReader) ([]string, error) {
+	var rows []string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestProjectionRowReader_Read(t *testing.T) {
+
+	Convey("Given a row reader returning a header and observations with three dimensions", t, func() {
+
+		rows := []string{
+			"V4_1,Data_Marking,calendar-years,Time,uk-only,Geography,cpi1dim1aggid,Aggregate\n",
+			"123,,2017,2017,K02000001,United Kingdom,cpi1dim1A0,\"CPI (overall index), all items\"\n",
+			"456,x,2018,2018,K02000001,United Kingdom,cpi1dim1A0,\"CPI (overall index), all items\"\n",
+		}
+
+		Convey("When a projection excluding the geography dimension is applied", func() {
+
+			reader := observation.NewProjectionRowReader(newMockRowReader(rows...), &observation.Projection{
+				Exclude: []string{"geography"},
+			})
+
+			actual, err := readAllRows(reader)
+
+			Convey("The header and observations are returned without the geography columns", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_1,Data_Marking,calendar-years,Time,cpi1dim1aggid,Aggregate\n",
+					"123,,2017,2017,cpi1dim1A0,\"CPI (overall index), all items\"\n",
+					"456,x,2018,2018,cpi1dim1A0,\"CPI (overall index), all items\"\n",
+				})
+			})
+		})
+
+		Convey("When a projection including only the time dimension is applied", func() {
+
+			reader := observation.NewProjectionRowReader(newMockRowReader(rows...), &observation.Projection{
+				Include: []string{"Time"},
+			})
+
+			actual, err := readAllRows(reader)
+
+			Convey("The header and observations are returned with only the time columns", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_1,Data_Marking,calendar-years,Time\n",
+					"123,,2017,2017\n",
+					"456,x,2018,2018\n",
+				})
+			})
+		})
+
+		Convey("When a projection including an unknown dimension is applied", func() {
+
+			reader := observation.NewProjectionRowReader(newMockRowReader(rows...), &observation.Projection{
+				Include: []string{"age"},
+			})
+
+			row, err := reader.Read()
+
+			Convey("The expected error is returned", func() {
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(row, ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestProjection_Validate(t *testing.T) {
+
+	Convey("Given a projection that both includes and excludes dimensions", t, func() {
+
+		projection := &observation.Projection{
+			Include: []string{"time"},
+			Exclude: []string{"geography"},
+		}
+
+		Convey("When the projection is validated", func() {
+
+			err := projection.Validate()
+
+			Convey("The expected error is returned", func() {
+				So(err, ShouldEqual, observation.ErrInvalidProjection)
+			})
+		})
+	})
+}
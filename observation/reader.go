@@ -1,23 +1,47 @@
 package observation
 
-import "io"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync"
+)
 
-// Check that the reader conforms to the io.reader interface.
-var _ io.Reader = (*Reader)(nil)
+// Check that the reader conforms to the io.reader and io.WriterTo interfaces.
+var (
+	_ io.Reader   = (*Reader)(nil)
+	_ io.WriterTo = (*Reader)(nil)
+)
+
+// writeBatchSize is the number of bytes of rows that WriteTo buffers before writing them.
+const writeBatchSize = 64 * 1024
+
+// batchPool holds the buffers used by WriteTo, so they can be reused between readers.
+var batchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, writeBatchSize)
+		return &b
+	},
+}
 
 // Reader is an io.Reader implementation that wraps a csvRowReader
 type Reader struct {
 	csvRowReader   CSVRowReader
-	buffer         []byte // buffer a portion of the current line
+	buffer         string // buffer a portion of the current line
 	eof            bool   // are we at the end of the csv rows?
 	totalBytesRead int64  // how many bytes in total have been read?
 	obsCount       int32
+	hash           hash.Hash // hash of the bytes read so far
+	closed         bool
+	closeErr       error
 }
 
 // NewReader returns a new io.Reader for the given csvRowReader.
 func NewReader(csvRowReader CSVRowReader) *Reader {
 	return &Reader{
 		csvRowReader: csvRowReader,
+		hash:         sha256.New(),
 	}
 }
 
@@ -25,7 +49,7 @@ func NewReader(csvRowReader CSVRowReader) *Reader {
 func (reader *Reader) Read(p []byte) (n int, err error) {
 
 	// check if the next line needs to be read.
-	if reader.buffer == nil || len(reader.buffer) == 0 {
+	if len(reader.buffer) == 0 {
 		csvRow, err := reader.csvRowReader.Read()
 		if err == io.EOF {
 			reader.eof = true
@@ -33,19 +57,20 @@ func (reader *Reader) Read(p []byte) (n int, err error) {
 			return 0, err
 		}
 
-		reader.buffer = []byte(csvRow)
+		reader.buffer = csvRow
 		reader.obsCount++
 	}
 
 	// copy into the given byte array.
 	copied := copy(p, reader.buffer)
 	reader.totalBytesRead += int64(copied)
+	reader.hash.Write(p[:copied])
 
 	// if the line is bigger than the array, slice the line to account for bytes read
 	if len(reader.buffer) > len(p) {
 		reader.buffer = reader.buffer[copied:]
 	} else { // the line is smaller than the array - clear the current line as it has all been read.
-		reader.buffer = nil
+		reader.buffer = ""
 
 		if reader.eof {
 			return copied, io.EOF
@@ -55,9 +80,75 @@ func (reader *Reader) Read(p []byte) (n int, err error) {
 	return copied, nil
 }
 
-// Close the reader.
+// WriteTo writes all remaining rows from the underlying csvRowReader to the given writer. Rows are batched
+// into pooled buffers so that many rows are written per call to the writer. It is used by io.Copy in
+// preference to Read.
+func (reader *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	bp := batchPool.Get().(*[]byte)
+	batch := (*bp)[:0]
+
+	defer func() {
+		// don't keep buffers that have grown to hold unusually large rows
+		if cap(batch) <= 4*writeBatchSize {
+			*bp = batch[:0]
+			batchPool.Put(bp)
+		}
+	}()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		written, err := w.Write(batch)
+		n += int64(written)
+		reader.totalBytesRead += int64(written)
+		reader.hash.Write(batch[:written])
+
+		if err == nil && written < len(batch) {
+			err = io.ErrShortWrite
+		}
+
+		batch = batch[:0]
+		return err
+	}
+
+	// include any portion of a line that has not been returned by Read.
+	batch = append(batch, reader.buffer...)
+	reader.buffer = ""
+
+	for !reader.eof {
+		csvRow, readErr := reader.csvRowReader.Read()
+		if readErr == io.EOF {
+			reader.eof = true
+		} else if readErr != nil {
+			if err := flush(); err != nil {
+				return n, err
+			}
+			return n, readErr
+		}
+
+		batch = append(batch, csvRow...)
+		reader.obsCount++
+
+		if len(batch) >= writeBatchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, flush()
+}
+
+// Close the reader. Closing the reader more than once has no further effect, and returns the same error.
 func (reader *Reader) Close() (err error) {
-	return reader.csvRowReader.Close()
+	if !reader.closed {
+		reader.closed = true
+		reader.closeErr = reader.csvRowReader.Close()
+	}
+
+	return reader.closeErr
 }
 
 // TotalBytesRead returns the total number of bytes read by this reader.
@@ -69,3 +160,9 @@ func (reader *Reader) TotalBytesRead() int64 {
 func (reader *Reader) ObservationsCount() int32 {
 	return reader.obsCount
 }
+
+// ContentHash returns the hex encoded SHA-256 hash of the bytes read so far. Once io.EOF has been returned
+// it is the hash of the entire content, so identical output can be detected without storing it.
+func (reader *Reader) ContentHash() string {
+	return hex.EncodeToString(reader.hash.Sum(nil))
+}
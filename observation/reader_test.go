@@ -1,8 +1,14 @@
 package observation_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ONSdigital/dp-filter/observation"
@@ -141,6 +147,138 @@ func TestReader_Read_MultipleLines(t *testing.T) {
 	})
 }
 
+func TestReader_ContentHash(t *testing.T) {
+
+	Convey("Given two readers with mock CSV row readers returning the same rows", t, func() {
+
+		rows := []string{"V4_0,time_codelist,time\n", "1,2017,2017\n", "2,2018,2018\n"}
+
+		reader1 := observation.NewReader(newMockRowReader(rows...))
+		reader2 := observation.NewReader(newMockRowReader(rows...))
+
+		Convey("When the readers are read to the end using different buffer sizes", func() {
+
+			_, err1 := io.Copy(ioutil.Discard, reader1)
+			_, err2 := io.CopyBuffer(ioutil.Discard, struct{ io.Reader }{reader2}, make([]byte, 5))
+
+			Convey("The content hashes are the same", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(reader1.ContentHash(), ShouldEqual, reader2.ContentHash())
+				So(reader1.ContentHash(), ShouldEqual, "a36103e79da1fa9ee32d27287e00bc1da3bd325cad5cba11ee5b47742e9028ad")
+			})
+		})
+	})
+}
+
+func TestReader_WriteTo(t *testing.T) {
+
+	Convey("Given a reader with a mock CSV row reader that returns several rows", t, func() {
+
+		rows := []string{"V4_0,time_codelist,time\n", "1,2017,2017\n", "2,2018,2018\n"}
+		expected := strings.Join(rows, "")
+
+		reader := observation.NewReader(newMockRowReader(rows...))
+
+		Convey("When part of the first row is read before the rest are written to a writer", func() {
+
+			start := make([]byte, 4)
+			_, readErr := reader.Read(start)
+
+			var buf bytes.Buffer
+			written, err := reader.WriteTo(&buf)
+
+			Convey("All of the content is returned and counted", func() {
+				So(readErr, ShouldBeNil)
+				So(err, ShouldBeNil)
+				So(written, ShouldEqual, len(expected)-4)
+				So(string(start)+buf.String(), ShouldEqual, expected)
+				So(reader.TotalBytesRead(), ShouldEqual, len(expected))
+				So(reader.ObservationsCount(), ShouldEqual, 4)
+
+				hash := sha256.Sum256([]byte(expected))
+				So(reader.ContentHash(), ShouldEqual, hex.EncodeToString(hash[:]))
+			})
+		})
+	})
+
+	Convey("Given a reader with a mock CSV row reader that returns an error after a row", t, func() {
+
+		expectedErr := errors.New("broken")
+		calls := 0
+
+		mockRowReader := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				calls++
+				if calls > 1 {
+					return "", expectedErr
+				}
+				return "1,2017,2017\n", nil
+			},
+		}
+
+		reader := observation.NewReader(mockRowReader)
+
+		Convey("When the rows are written to a writer", func() {
+
+			var buf bytes.Buffer
+			written, err := reader.WriteTo(&buf)
+
+			Convey("The rows read before the error are written and the error is returned", func() {
+				So(err, ShouldEqual, expectedErr)
+				So(written, ShouldEqual, 12)
+				So(buf.String(), ShouldEqual, "1,2017,2017\n")
+			})
+		})
+	})
+}
+
+// benchRowReader returns the same row a fixed number of times without allocating.
+type benchRowReader struct {
+	row  string
+	rows int
+}
+
+func (reader *benchRowReader) Read() (string, error) {
+	if reader.rows == 0 {
+		return "", io.EOF
+	}
+	reader.rows--
+	return reader.row, nil
+}
+
+func (reader *benchRowReader) Close() error {
+	return nil
+}
+
+const benchRow = "123.4,,Month,Jan-20,K02000001,United Kingdom,cpih1dim1A0,CPIH (overall index)\n"
+
+func BenchmarkReader_Read(b *testing.B) {
+	b.SetBytes(int64(len(benchRow)) * 10000)
+	buf := make([]byte, 32*1024)
+
+	for i := 0; i < b.N; i++ {
+		reader := observation.NewReader(&benchRowReader{row: benchRow, rows: 10000})
+
+		// hide WriteTo so that io.CopyBuffer uses Read
+		if _, err := io.CopyBuffer(ioutil.Discard, struct{ io.Reader }{reader}, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReader_WriteTo(b *testing.B) {
+	b.SetBytes(int64(len(benchRow)) * 10000)
+
+	for i := 0; i < b.N; i++ {
+		reader := observation.NewReader(&benchRowReader{row: benchRow, rows: 10000})
+
+		if _, err := reader.WriteTo(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestReader_Read_Error(t *testing.T) {
 
 	Convey("Given a reader with a mock CSV row reader that returns an error", t, func() {
@@ -170,3 +308,31 @@ func TestReader_Read_Error(t *testing.T) {
 		})
 	})
 }
+
+func TestReader_Close(t *testing.T) {
+
+	Convey("Given a reader with a mock CSV row reader that fails to close", t, func() {
+
+		closeErr := errors.New("close failed")
+
+		mockRowReader := &observationtest.CSVRowReaderMock{
+			CloseFunc: func() error {
+				return closeErr
+			},
+		}
+
+		reader := observation.NewReader(mockRowReader)
+
+		Convey("When close is called twice", func() {
+
+			first := reader.Close()
+			second := reader.Close()
+
+			Convey("The CSV row reader is only closed once and its error is returned each time", func() {
+				So(first, ShouldEqual, closeErr)
+				So(second, ShouldEqual, closeErr)
+				So(len(mockRowReader.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"io"
 
 	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
-	"github.com/johnnadratowski/golang-neo4j-bolt-driver/errors"
 )
 
 //go:generate moq -out observationtest/bolt_rows.go -pkg observationtest . BoltRows
@@ -30,6 +29,11 @@ type BoltRowReader struct {
 	rows       BoltRows
 	connection DBConnection
 	rowsRead   int
+	header     string  // the header row, if it is not the first row returned by the database
+	filter     *Filter // the filter the rows are read for, used to describe errors
+	err        error   // the error returned by Read once the rows have been read or have failed
+	closed     bool
+	closeErr   error
 }
 
 // NewBoltRowReader returns a new reader instace for the given bolt rows.
@@ -40,34 +44,81 @@ func NewBoltRowReader(rows BoltRows, connection DBConnection) *BoltRowReader {
 	}
 }
 
-// ErrNoDataReturned is returned if a Neo4j row has no data.
-var ErrNoDataReturned = errors.New("no data returned in this row")
+// NewBoltRowReaderWithHeader returns a new reader instance for the given bolt rows, which returns the given
+// header row before the rows. The bolt rows are expected to only contain observations.
+func NewBoltRowReaderWithHeader(header string, rows BoltRows, connection DBConnection) *BoltRowReader {
+	return &BoltRowReader{
+		rows:       rows,
+		connection: connection,
+		header:     header,
+	}
+}
 
-// ErrUnrecognisedType is returned if a Neo4j row does not have the expected string value.
-var ErrUnrecognisedType = errors.New("the value returned was not a string")
+// forFilter sets the filter the rows are being read for.
+func (reader *BoltRowReader) forFilter(filter *Filter) *BoltRowReader {
+	reader.filter = filter
+	return reader
+}
 
-// ErrNoInstanceFound is returned if no instance exists in neo4j
-var ErrNoInstanceFound = errors.New("no instance found in datastore")
+// Read the next row, or return io.EOF. The first row is the instance header, either given to the reader or
+// read from the database. Errors other than io.EOF are returned as an *Error. The reader is closed once
+// io.EOF or an error is returned, and the same error is returned by each later call. ErrReaderClosed is
+// returned if the reader was closed before then.
+func (reader *BoltRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
 
-// ErrNoResultsFound is returned if the selected filter options produce no results
-var ErrNoResultsFound = errors.New("the filter options created no results")
+	if reader.closed {
+		return "", ErrReaderClosed
+	}
+
+	row, err := reader.read()
+	if err != nil {
+		reader.err = err
+		// the error of closing the reader is returned by Close, as it does not affect the rows read
+		reader.Close()
+		return "", err
+	}
+
+	return row, nil
+}
+
+func (reader *BoltRowReader) read() (string, error) {
+	if reader.rowsRead == 0 && reader.header != "" {
+		reader.rowsRead++
+		return reader.header + "\n", nil
+	}
 
-// Read the next row, or return io.EOF
-func (reader *BoltRowReader) Read() (string, error) {
 	data, _, err := reader.rows.NextNeo()
 	if err != nil {
 		if err == io.EOF {
 			if reader.rowsRead == 0 {
-				return "", ErrNoInstanceFound
+				return "", newError(ErrNoInstanceFound, reader.filter, nil)
 			} else if reader.rowsRead == 1 {
-				return "", ErrNoResultsFound
+				return "", newError(ErrNoResultsFound, reader.filter, nil)
 			}
+			return "", io.EOF
 		}
-		return "", err
+		return "", newDriverError(reader.filter, err)
 	}
 
 	if len(data) < 1 {
-		return "", ErrNoDataReturned
+		return "", newError(ErrNoDataReturned, reader.filter, nil)
+	}
+
+	if reader.filter != nil && reader.filter.Aggregation != nil {
+		csvRow, err := FormatAggregatedRow(data)
+		if err != nil {
+			return "", newError(err, reader.filter, nil)
+		}
+		reader.rowsRead++
+		return csvRow + "\n", nil
+	}
+
+	// the header row is returned even if the instance has no header property
+	if reader.rowsRead == 0 && (data[0] == nil || data[0] == "") {
+		return "", newError(ErrNoHeaderFound, reader.filter, nil)
 	}
 
 	if csvRow, ok := data[0].(string); ok {
@@ -75,14 +126,17 @@ func (reader *BoltRowReader) Read() (string, error) {
 		return csvRow + "\n", nil
 	}
 
-	return "", ErrUnrecognisedType
+	return "", newError(ErrUnrecognisedType, reader.filter, nil)
 }
 
-// Close the reader and the connection (For pooled connections this will release it back into the pool)
+// Close the rows and the connection (For pooled connections this will release it back into the pool). The
+// connection is closed even if the rows fail to close, and the errors of both are returned as a MultiError.
+// Closing the reader more than once has no further effect, and returns the same error.
 func (reader *BoltRowReader) Close() error {
-	err := reader.rows.Close()
-	if err != nil {
-		return err
+	if !reader.closed {
+		reader.closed = true
+		reader.closeErr = combineErrors(reader.rows.Close(), reader.connection.Close())
 	}
-	return reader.connection.Close()
+
+	return reader.closeErr
 }
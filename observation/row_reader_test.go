@@ -1,6 +1,7 @@
 package observation_test
 
 import (
+	"errors"
 	"io"
 	"testing"
 
@@ -71,7 +72,7 @@ func TestBoltRowReader_ReadError(t *testing.T) {
 
 			Convey("The error from the Bolt reader is returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err, ShouldEqual, observation.ErrNoInstanceFound)
+				So(errors.Is(err, observation.ErrNoInstanceFound), ShouldBeTrue)
 				So(row, ShouldEqual, "")
 			})
 		})
@@ -105,7 +106,7 @@ func TestBoltRowReader_Read_NoDataError(t *testing.T) {
 
 			Convey("The expected error is returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err, ShouldEqual, observation.ErrNoDataReturned)
+				So(errors.Is(err, observation.ErrNoDataReturned), ShouldBeTrue)
 				So(row, ShouldEqual, "")
 			})
 		})
@@ -139,13 +140,110 @@ func TestBoltRowReader_Read_TypeError(t *testing.T) {
 
 			Convey("The expected error is returned", func() {
 				So(err, ShouldNotBeNil)
-				So(err, ShouldEqual, observation.ErrUnrecognisedType)
+				So(errors.Is(err, observation.ErrUnrecognisedType), ShouldBeTrue)
 				So(row, ShouldEqual, "")
 			})
 		})
 	})
 }
 
+func TestBoltRowReader_Read_NoHeaderError(t *testing.T) {
+
+	Convey("Given a row reader with a mock Bolt reader that returns an instance without a header.", t, func() {
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return nil
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				return []interface{}{nil}, nil, nil
+			},
+		}
+
+		rowReader := observation.NewBoltRowReader(mockBoltRows, newConnectionMock(nil))
+
+		Convey("When read is called", func() {
+
+			row, err := rowReader.Read()
+
+			Convey("The expected error is returned", func() {
+				So(errors.Is(err, observation.ErrNoHeaderFound), ShouldBeTrue)
+				So(errors.Is(err, observation.ErrNoInstanceFound), ShouldBeFalse)
+				So(row, ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestBoltRowReader_Read_DriverError(t *testing.T) {
+
+	Convey("Given a row reader with a mock Bolt reader that returns a driver error.", t, func() {
+
+		driverErr := errors.New("connection reset")
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return nil
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				return nil, nil, driverErr
+			},
+		}
+
+		rowReader := observation.NewBoltRowReader(mockBoltRows, newConnectionMock(nil))
+
+		Convey("When read is called", func() {
+
+			_, err := rowReader.Read()
+
+			Convey("The error describes a driver failure and wraps the driver error", func() {
+				So(errors.Is(err, observation.ErrDriver), ShouldBeTrue)
+				So(errors.Is(err, driverErr), ShouldBeTrue)
+
+				var observationErr *observation.Error
+				So(errors.As(err, &observationErr), ShouldBeTrue)
+				So(observationErr.Cause, ShouldEqual, driverErr)
+			})
+		})
+	})
+}
+
+func TestBoltRowReader_Read_NoResultsError(t *testing.T) {
+
+	Convey("Given a row reader with a mock Bolt reader that only returns a header.", t, func() {
+
+		rows := [][]interface{}{{"V4_0,time_codelist,time"}}
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return nil
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				if len(rows) == 0 {
+					return nil, nil, io.EOF
+				}
+				row := rows[0]
+				rows = rows[1:]
+				return row, nil, nil
+			},
+		}
+
+		rowReader := observation.NewBoltRowReader(mockBoltRows, newConnectionMock(nil))
+
+		Convey("When read is called after the header", func() {
+
+			header, headerErr := rowReader.Read()
+			_, err := rowReader.Read()
+
+			Convey("The header is returned followed by the expected error", func() {
+				So(headerErr, ShouldBeNil)
+				So(header, ShouldEqual, "V4_0,time_codelist,time\n")
+				So(errors.Is(err, observation.ErrNoResultsFound), ShouldBeTrue)
+			})
+		})
+	})
+}
+
 func TestBoltRowReader_BoltConnection_Closed(t *testing.T) {
 	Convey("Given a row reader with a mock Bolt reader.", t, func() {
 		mockBoltRows := &observationtest.BoltRowsMock{
@@ -172,3 +270,138 @@ func TestBoltRowReader_BoltConnection_Closed(t *testing.T) {
 		})
 	})
 }
+
+func TestBoltRowReader_ReadWithHeader(t *testing.T) {
+
+	Convey("Given a row reader with a header and a mock Bolt reader that returns no observations", t, func() {
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return nil
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				return nil, nil, io.EOF
+			},
+		}
+
+		rowReader := observation.NewBoltRowReaderWithHeader("V4_0,time_codelist,time", mockBoltRows, newConnectionMock(nil))
+
+		Convey("When read is called twice", func() {
+
+			header, headerErr := rowReader.Read()
+			_, err := rowReader.Read()
+
+			Convey("The header is returned without reading the Bolt rows, followed by the expected error", func() {
+				So(headerErr, ShouldBeNil)
+				So(header, ShouldEqual, "V4_0,time_codelist,time\n")
+				So(errors.Is(err, observation.ErrNoResultsFound), ShouldBeTrue)
+				So(len(mockBoltRows.NextNeoCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func newConnectionMock(err error) *observationtest.DBConnectionMock {
+	return &observationtest.DBConnectionMock{
+		CloseFunc: func() error {
+			return err
+		},
+	}
+}
+
+func TestBoltRowReader_Close(t *testing.T) {
+
+	Convey("Given a row reader with a mock Bolt reader that fails to close", t, func() {
+
+		rowsErr := errors.New("rows close failed")
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return rowsErr
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				return []interface{}{"the,csv,row"}, nil, nil
+			},
+		}
+
+		Convey("When the row reader is closed", func() {
+
+			mockConnection := newConnectionMock(nil)
+			rowReader := observation.NewBoltRowReader(mockBoltRows, mockConnection)
+			err := rowReader.Close()
+
+			Convey("The connection is still released and the error of the rows is returned", func() {
+				So(err, ShouldEqual, rowsErr)
+				So(len(mockConnection.CloseCalls()), ShouldEqual, 1)
+			})
+
+			Convey("Closing it again has no further effect", func() {
+				So(rowReader.Close(), ShouldEqual, rowsErr)
+				So(len(mockBoltRows.CloseCalls()), ShouldEqual, 1)
+				So(len(mockConnection.CloseCalls()), ShouldEqual, 1)
+			})
+
+			Convey("Reading returns ErrReaderClosed", func() {
+				_, err := rowReader.Read()
+				So(err, ShouldEqual, observation.ErrReaderClosed)
+				So(len(mockBoltRows.NextNeoCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the row reader is closed and the connection also fails to close", func() {
+
+			connErr := errors.New("connection close failed")
+			rowReader := observation.NewBoltRowReader(mockBoltRows, newConnectionMock(connErr))
+			err := rowReader.Close()
+
+			Convey("Both errors are returned", func() {
+				So(err, ShouldResemble, observation.MultiError{rowsErr, connErr})
+				So(errors.Is(err, rowsErr), ShouldBeTrue)
+				So(errors.Is(err, connErr), ShouldBeTrue)
+				So(err.Error(), ShouldEqual, "rows close failed; connection close failed")
+			})
+		})
+	})
+
+	Convey("Given a row reader with a mock Bolt reader that returns a header and an observation", t, func() {
+
+		rows := [][]interface{}{{"V4_0,time_codelist,time"}, {"1,2020,2020"}}
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return nil
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				if len(rows) == 0 {
+					return nil, nil, io.EOF
+				}
+				row := rows[0]
+				rows = rows[1:]
+				return row, nil, nil
+			},
+		}
+
+		mockConnection := newConnectionMock(nil)
+		rowReader := observation.NewBoltRowReader(mockBoltRows, mockConnection)
+
+		Convey("When the rows are read to the end", func() {
+
+			readAllRows(rowReader)
+
+			Convey("The reader is closed, releasing the connection", func() {
+				So(len(mockBoltRows.CloseCalls()), ShouldEqual, 1)
+				So(len(mockConnection.CloseCalls()), ShouldEqual, 1)
+			})
+
+			Convey("Reading again returns io.EOF", func() {
+				_, err := rowReader.Read()
+				So(err, ShouldEqual, io.EOF)
+			})
+
+			Convey("Closing the reader has no further effect", func() {
+				So(rowReader.Close(), ShouldBeNil)
+				So(len(mockConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,314 @@
+package observation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// shardBufferSize is the number of rows each shard reads ahead of the merged reader.
+const shardBufferSize = 1000
+
+// GetCSVRowsSharded returns a reader for the rows of the filter, extracted by running a separate query for
+// each option of the given dimension. Up to concurrency queries are run at once, each on its own pooled
+// connection. The header is returned once, followed by the rows of each shard in order of option code.
+// Within each shard rows are ordered by filter.Sort, or by observation if it is not set. Aggregated filters
+// cannot be sharded, as the rows of a group could be in more than one shard, and nor can complete grids.
+func (store *Store) GetCSVRowsSharded(ctx context.Context, filter *Filter, dimension string, concurrency int) (CSVRowReader, error) {
+	start := time.Now()
+
+	if err := store.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	if filter.Aggregation != nil {
+		return nil, ErrAggregationNotSupported
+	}
+
+	if filter.Sparsity != nil {
+		return nil, ErrSparsityNotSupported
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// graph labels are lower case, and the dimension is found in the header ignoring case
+	dimension = strings.ToLower(dimension)
+
+	header, options, err := store.getShardOptions(ctx, filter, dimension)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &shardedRowReader{
+		ctx:    ctx,
+		store:  store,
+		filter: filter,
+		header: header,
+		slots:  make(chan struct{}, concurrency),
+		done:   make(chan struct{}),
+	}
+
+	for _, option := range options {
+		reader.shards = append(reader.shards, &shard{
+			filter: createShardFilter(filter, dimension, option),
+			rows:   make(chan shardRow, shardBufferSize),
+		})
+	}
+
+	reader.wg.Add(1)
+	go reader.startShards()
+
+	rowReader := store.newTimeoutRowReader(ctx, reader, filter, start)
+
+	if filter.Projection != nil {
+		rowReader = NewProjectionRowReader(rowReader, filter.Projection)
+	}
+
+	return rowReader, nil
+}
+
+// getShardOptions returns the header of the filtered instance and the option codes to shard the given
+// dimension by. These are the filtered options of the dimension, or all of its options if it is not filtered.
+func (store *Store) getShardOptions(ctx context.Context, filter *Filter, dimension string) (string, []string, error) {
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+
+	header, err := getHeader(conn, filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := store.limits.checkEstimatedRows(conn, filter, header); err != nil {
+		return "", nil, err
+	}
+
+	parsed, err := ParseHeader(header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if parsed.Dimension(dimension) == nil {
+		return "", nil, ErrUnknownDimension
+	}
+
+	if err := CheckSortDimensions(filter, header); err != nil {
+		return "", nil, err
+	}
+
+	var options []string
+	for _, dimensionFilter := range filter.DimensionFilters {
+		if strings.EqualFold(dimensionFilter.Name, dimension) {
+			options = append(options, dimensionFilter.Options...)
+		}
+	}
+
+	if len(options) > 0 {
+		return header, sortedUnique(options), nil
+	}
+
+	options, err = queryOptionCodes(conn, filter, dimension)
+	return header, options, err
+}
+
+// queryOptionCodes returns the codes of all options of the given dimension, in order.
+func queryOptionCodes(conn bolt.Conn, filter *Filter, dimension string) ([]string, error) {
+	query := fmt.Sprintf("MATCH (d:`_%s_%s`) RETURN d.value AS code ORDER BY code", filter.InstanceID, dimension)
+
+	data, _, _, err := conn.QueryNeoAll(query, nil)
+	if err != nil {
+		return nil, newDriverError(filter, err)
+	}
+
+	codes := make([]string, 0, len(data))
+	for _, row := range data {
+		if len(row) < 1 {
+			return nil, newError(ErrNoDataReturned, filter, nil)
+		}
+
+		code, ok := row[0].(string)
+		if !ok {
+			return nil, newError(ErrUnrecognisedType, filter, nil)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// createShardFilter returns a copy of the filter restricted to a single option of the given dimension.
+func createShardFilter(filter *Filter, dimension, option string) *Filter {
+	shardFilter := *filter
+	shardFilter.DimensionFilters = nil
+
+	for _, dimensionFilter := range filter.DimensionFilters {
+		if !strings.EqualFold(dimensionFilter.Name, dimension) {
+			shardFilter.DimensionFilters = append(shardFilter.DimensionFilters, dimensionFilter)
+		}
+	}
+
+	shardFilter.DimensionFilters = append(shardFilter.DimensionFilters, &DimensionFilter{
+		Name:    dimension,
+		Options: []string{option},
+	})
+
+	// sorting by the shard dimension orders the rows by observation, as each shard has a single option
+	if len(shardFilter.Sort) == 0 {
+		shardFilter.Sort = []*SortDimension{{Name: dimension}}
+	}
+
+	return &shardFilter
+}
+
+// shard is a query for a single option of the sharded dimension.
+type shard struct {
+	filter *Filter
+	rows   chan shardRow // closed once all rows of the shard have been sent
+}
+
+type shardRow struct {
+	row string
+	err error
+}
+
+// shardedRowReader merges the rows of each shard, in order, after the header.
+type shardedRowReader struct {
+	ctx        context.Context
+	store      *Store
+	filter     *Filter
+	header     string
+	shards     []*shard
+	current    int           // the index of the shard being read
+	headerRead bool          // whether the header has been returned
+	rowsRead   int           // the number of observations returned
+	err        error         // the error that ended the rows, returned by each read once reached
+	slots      chan struct{} // limits the number of shards querying at once
+	done       chan struct{} // closed to stop all shards
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+// startShards starts each shard in order once a slot is available.
+func (reader *shardedRowReader) startShards() {
+	defer reader.wg.Done()
+
+	for _, s := range reader.shards {
+		select {
+		case reader.slots <- struct{}{}:
+		case <-reader.done:
+			return
+		}
+
+		reader.wg.Add(1)
+		go reader.runShard(s)
+	}
+}
+
+// runShard queries the rows of a shard, sending them to the shard channel until they have all been sent or
+// the reader is closed.
+func (reader *shardedRowReader) runShard(s *shard) {
+	defer reader.wg.Done()
+	defer func() { <-reader.slots }()
+	defer close(s.rows)
+
+	send := func(row shardRow) bool {
+		select {
+		case s.rows <- row:
+			return true
+		case <-reader.done:
+			return false
+		}
+	}
+
+	conn, err := reader.store.openConn(reader.ctx, s.filter)
+	if err != nil {
+		send(shardRow{err: err})
+		return
+	}
+
+	rowReader, err := reader.store.queryObservations(reader.ctx, conn, s.filter, reader.header, nil)
+	if err != nil {
+		send(shardRow{err: err})
+		return
+	}
+	defer rowReader.Close()
+
+	// the header is returned once by the merged reader rather than by each shard
+	if _, err := rowReader.Read(); err != nil {
+		send(shardRow{err: err})
+		return
+	}
+
+	for {
+		row, err := rowReader.Read()
+		if err == io.EOF || errors.Is(err, ErrNoResultsFound) {
+			return
+		}
+
+		if !send(shardRow{row: row, err: err}) || err != nil {
+			return
+		}
+	}
+}
+
+// Read the header, then the rows of each shard in turn, or return io.EOF
+func (reader *shardedRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	select {
+	case <-reader.done:
+		return "", ErrReaderClosed
+	default:
+	}
+
+	if !reader.headerRead {
+		reader.headerRead = true
+		return reader.header + "\n", nil
+	}
+
+	for reader.current < len(reader.shards) {
+		row, ok := <-reader.shards[reader.current].rows
+		if !ok {
+			reader.current++
+			continue
+		}
+
+		if row.err != nil {
+			reader.err = row.err
+			return "", row.err
+		}
+
+		reader.rowsRead++
+		return row.row, nil
+	}
+
+	if reader.rowsRead == 0 {
+		reader.err = newError(ErrNoResultsFound, reader.filter, nil)
+	} else {
+		reader.err = io.EOF
+	}
+
+	return "", reader.err
+}
+
+// Close stops any running shards, waiting for them to release their connections.
+func (reader *shardedRowReader) Close() error {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+		reader.wg.Wait()
+	})
+
+	return nil
+}
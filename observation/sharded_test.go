@@ -0,0 +1,256 @@
+package observation_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newShardConnection returns a mock connection returning the header, the given option codes of the sex
+// dimension, and an observation row for each age and sex option in the query.
+func newShardConnection(codes []string, rowsBySex map[string][]string) *observationtest.ConnMock {
+	return &observationtest.ConnMock{
+		QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+			if strings.HasSuffix(query, "RETURN i.header as row") {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			}
+			var data [][]interface{}
+			for _, code := range codes {
+				data = append(data, []interface{}{code})
+			}
+			return data, nil, nil, nil
+		},
+		QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+			var rows []string
+			for sex, sexRows := range rowsBySex {
+				if strings.Contains(query, "`sex`.value='"+sex+"'") {
+					rows = sexRows
+				}
+			}
+
+			return &observationtest.BoltRowsMock{
+				NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+					if len(rows) == 0 {
+						return nil, nil, io.EOF
+					}
+					row := rows[0]
+					rows = rows[1:]
+					return []interface{}{row}, nil, nil
+				},
+				CloseFunc: func() error {
+					return nil
+				},
+			}, nil
+		},
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+func TestStore_GetCSVRowsSharded(t *testing.T) {
+
+	Convey("Given a store with a mock DB pool returning a new connection each time", t, func() {
+
+		rowsBySex := map[string][]string{
+			"female": {"1,29,29,female,Female", "2,30,30,female,Female"},
+			"male":   {"3,29,29,male,Male"},
+			"other":  {},
+		}
+
+		var mutex sync.Mutex
+		var connections []*observationtest.ConnMock
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				conn := newShardConnection([]string{"female", "male", "other"}, rowsBySex)
+				connections = append(connections, conn)
+				return conn, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetCSVRowsSharded is called for a dimension that is not filtered", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"29", "30"}},
+				},
+			}
+
+			reader, err := store.GetCSVRowsSharded(testContext, filter, "sex", 2)
+			So(err, ShouldBeNil)
+
+			rows, readErr := readAllRows(reader)
+			closeErr := reader.Close()
+
+			Convey("The header is returned once followed by the rows of each option in order", func() {
+				So(readErr, ShouldBeNil)
+				So(closeErr, ShouldBeNil)
+				So(rows, ShouldResemble, []string{
+					expectedHeader + "\n",
+					"1,29,29,female,Female\n",
+					"2,30,30,female,Female\n",
+					"3,29,29,male,Male\n",
+				})
+			})
+
+			Convey("A query is run on a separate connection for each option, and every connection is released", func() {
+				So(len(connections), ShouldEqual, 4)
+
+				So(connections[0].QueryNeoAllCalls()[1].Query, ShouldEqual, "MATCH (d:`_888_sex`) RETURN d.value AS code ORDER BY code")
+
+				var queries []string
+				for _, conn := range connections[1:] {
+					So(len(conn.QueryNeoCalls()), ShouldEqual, 1)
+					queries = append(queries, conn.QueryNeoCalls()[0].Query)
+				}
+				So(queries, ShouldContain, "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) "+
+					"WHERE (`age`.value='29' OR `age`.value='30') AND (`sex`.value='female') "+
+					"RETURN o.value AS row ORDER BY `sex`.value, o.value")
+
+				for _, conn := range connections {
+					So(len(conn.CloseCalls()), ShouldEqual, 1)
+				}
+			})
+		})
+
+		Convey("When GetCSVRowsSharded is called for a filtered dimension", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "sex", Options: []string{"male", "other"}},
+				},
+			}
+
+			reader, err := store.GetCSVRowsSharded(testContext, filter, "sex", 1)
+			So(err, ShouldBeNil)
+
+			rows, readErr := readAllRows(reader)
+			reader.Close()
+
+			Convey("Only the filtered options are queried", func() {
+				So(readErr, ShouldBeNil)
+				So(rows, ShouldResemble, []string{expectedHeader + "\n", "3,29,29,male,Male\n"})
+				So(len(connections), ShouldEqual, 3)
+				So(len(connections[0].QueryNeoAllCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetCSVRowsSharded is called for a published filter on a dimension named in a different case", func() {
+
+			mockedLogger := &observationtest.LoggerMock{
+				LogFunc: func(ctx context.Context, level observation.Level, event string, data map[string]interface{}, err error) {
+				},
+			}
+			store := observation.NewStore(mockedPool, observation.WithLogger(mockedLogger))
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				Published:  &observation.Published,
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "sex", Options: []string{"male"}},
+				},
+			}
+
+			reader, err := store.GetCSVRowsSharded(testContext, filter, "Sex", 1)
+			So(err, ShouldBeNil)
+
+			rows, readErr := readAllRows(reader)
+			reader.Close()
+
+			Convey("The filtered options are queried using the lower case dimension", func() {
+				So(readErr, ShouldBeNil)
+				So(rows, ShouldResemble, []string{expectedHeader + "\n", "3,29,29,male,Male\n"})
+				So(len(connections), ShouldEqual, 2)
+				So(connections[1].QueryNeoCalls()[0].Query, ShouldEqual, "MATCH (o)-[:isValueOf]->(`sex`:`_888_sex`) "+
+					"WHERE (`sex`.value='male') RETURN o.value AS row ORDER BY `sex`.value, o.value")
+			})
+
+			Convey("The shard query is logged without redacting the options of the published filter", func() {
+				calls := mockedLogger.LogCalls()
+				So(calls, ShouldNotBeEmpty)
+				So(calls[len(calls)-1].Data["query"], ShouldEqual, connections[1].QueryNeoCalls()[0].Query)
+			})
+		})
+
+		Convey("When GetCSVRowsSharded is called for options with no observations", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "sex", Options: []string{"other"}},
+				},
+			}
+
+			reader, err := store.GetCSVRowsSharded(testContext, filter, "sex", 1)
+			So(err, ShouldBeNil)
+
+			rows, readErr := readAllRows(reader)
+			reader.Close()
+
+			Convey("The header is returned followed by the expected error", func() {
+				So(rows, ShouldResemble, []string{expectedHeader + "\n"})
+				So(errors.Is(readErr, observation.ErrNoResultsFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("When GetCSVRowsSharded is called for a dimension that is not in the instance", func() {
+
+			reader, err := store.GetCSVRowsSharded(testContext, &observation.Filter{InstanceID: "888"}, "time", 1)
+
+			Convey("The expected error is returned", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+			})
+		})
+
+		Convey("When GetCSVRowsSharded is called for an aggregated filter", func() {
+
+			filter := &observation.Filter{
+				InstanceID:  "888",
+				Aggregation: &observation.Aggregation{GroupBy: []string{"sex"}, Function: observation.AggregateSum},
+			}
+			reader, err := store.GetCSVRowsSharded(testContext, filter, "age", 1)
+
+			Convey("ErrAggregationNotSupported is returned", func() {
+				So(reader, ShouldBeNil)
+				So(err, ShouldEqual, observation.ErrAggregationNotSupported)
+			})
+		})
+
+		Convey("When the reader is closed before the rows have been read", func() {
+
+			reader, err := store.GetCSVRowsSharded(testContext, &observation.Filter{InstanceID: "888"}, "sex", 3)
+			So(err, ShouldBeNil)
+
+			reader.Read()
+			So(reader.Close(), ShouldBeNil)
+
+			_, readErr := reader.Read()
+
+			Convey("Every connection that was opened is released", func() {
+				So(readErr, ShouldEqual, observation.ErrReaderClosed)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				for _, conn := range connections {
+					So(len(conn.CloseCalls()), ShouldEqual, 1)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,394 @@
+package observation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// ErrInvalidSparsity is returned if a filter requests a complete grid of aggregated observations.
+var ErrInvalidSparsity = errors.New("a complete grid cannot be combined with an aggregation")
+
+// ErrSparsityNotSupported is returned by queries that cannot fill in a complete grid of observations.
+var ErrSparsityNotSupported = errors.New("complete grids are not supported by this query")
+
+// Default markers of a complete grid, used unless the filter sets its own.
+const (
+	DefaultMissingMarker    = ".."
+	DefaultSuppressedMarker = "x"
+)
+
+// Check that the sparsity row reader conforms to the CSVRowReader interface.
+var _ CSVRowReader = (*SparsityRowReader)(nil)
+
+// Sparsity requests a complete grid of observations: a row for every combination of the selected options,
+// using all of the options of any dimension that is not filtered. Combinations without an observation are
+// written with the missing marker, and observations without a value with the suppressed marker.
+type Sparsity struct {
+	MissingMarker    string `json:"missing_marker,omitempty"`
+	SuppressedMarker string `json:"suppressed_marker,omitempty"`
+}
+
+// Markers returns the missing and suppressed markers of the grid, using the defaults if they are not set.
+func (sparsity *Sparsity) Markers() (missing, suppressed string) {
+	missing, suppressed = sparsity.MissingMarker, sparsity.SuppressedMarker
+	if missing == "" {
+		missing = DefaultMissingMarker
+	}
+	if suppressed == "" {
+		suppressed = DefaultSuppressedMarker
+	}
+
+	return missing, suppressed
+}
+
+// GridDimension is a dimension of a complete grid, with its options in the order the rows are sorted on.
+type GridDimension struct {
+	Name       string
+	Options    []*DimensionOption
+	Descending bool
+}
+
+// prepareGrid returns a copy of the filter sorted on every dimension of the instance, starting with the
+// sort dimensions of the filter, and the options of each dimension in that order.
+func prepareGrid(conn bolt.Conn, filter *Filter, header string) (*Filter, []*GridDimension, error) {
+	parsed, err := ParseHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	normalised := Filter{DimensionFilters: filter.DimensionFilters}
+	normalised.Normalise()
+
+	selected := make(map[string][]string)
+	for _, dimension := range normalised.DimensionFilters {
+		selected[strings.ToLower(dimension.Name)] = dimension.Options
+	}
+
+	grid := newGridFilter(filter, parsed)
+
+	var dimensions []*GridDimension
+	for _, dimension := range grid.Sort {
+		name := strings.ToLower(dimension.Name)
+		if parsed.Dimension(name) == nil {
+			return nil, nil, ErrUnknownDimension
+		}
+
+		query := fmt.Sprintf("MATCH (d:`_%s_%s`) RETURN d.value AS code, d.label AS label, 0 AS count", filter.InstanceID, name)
+		options, err := queryOptions(conn, filter, query)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if codes, ok := selected[name]; ok {
+			options = selectOptions(options, codes)
+		}
+
+		descending := dimension.Descending
+		sort.Slice(options, func(i, j int) bool {
+			if descending {
+				return options[i].Code > options[j].Code
+			}
+			return options[i].Code < options[j].Code
+		})
+
+		dimensions = append(dimensions, &GridDimension{
+			Name:       name,
+			Options:    options,
+			Descending: descending,
+		})
+	}
+
+	return grid, dimensions, nil
+}
+
+// newGridFilter returns a copy of the filter sorted on every dimension of the instance with the given
+// header, starting with the sort dimensions of the filter.
+func newGridFilter(filter *Filter, header *Header) *Filter {
+	sorted := make(map[string]bool)
+	gridSort := make([]*SortDimension, 0, len(header.Dimensions))
+	for _, dimension := range filter.Sort {
+		gridSort = append(gridSort, dimension)
+		sorted[strings.ToLower(dimension.Name)] = true
+	}
+	for _, name := range header.DimensionNames() {
+		if name = strings.ToLower(name); !sorted[name] {
+			gridSort = append(gridSort, &SortDimension{Name: name})
+		}
+	}
+
+	grid := *filter
+	grid.Sort = gridSort
+
+	return &grid
+}
+
+// selectOptions returns the options with the given codes. Selected codes that are not options of the
+// dimension have no observations to fill in, so are dropped.
+func selectOptions(options []*DimensionOption, codes []string) []*DimensionOption {
+	wanted := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		wanted[code] = true
+	}
+
+	var selected []*DimensionOption
+	for _, option := range options {
+		if wanted[option.Code] {
+			selected = append(selected, option)
+		}
+	}
+
+	return selected
+}
+
+// SparsityRowReader wraps a CSVRowReader, filling in a row for each combination of the options of the grid
+// dimensions that the underlying reader does not return. The first row read from the underlying reader is
+// expected to be the instance header, and the rows after it must be sorted on the codes of the grid
+// dimensions, in order. Rows are written in the header's columns so the reader can be projected.
+type SparsityRowReader struct {
+	reader     CSVRowReader
+	dimensions []*GridDimension
+	filter     *Filter
+	missing    string
+	suppressed string
+	limit      *int // the maximum number of rows to return after the header, or nil for no limit
+
+	width        int   // the number of columns of the header
+	codeColumns  []int // the code column of each grid dimension
+	labelColumns []int
+	position     []int    // the index of the current option of each grid dimension
+	done         bool     // whether every combination of options has been returned
+	fields       []string // the fields of the current underlying row, or nil once all the rows have been read
+	row          string   // the current underlying row
+	count        int
+
+	started  bool
+	err      error // the error returned by Read once the rows have been read or have failed
+	closed   bool
+	closeErr error
+}
+
+// NewSparsityRowReader returns a new row reader filling in the combinations of options of the given
+// dimensions that are missing from the underlying reader. If limit is not nil then at most that many rows
+// are returned after the header.
+func NewSparsityRowReader(reader CSVRowReader, dimensions []*GridDimension, sparsity Sparsity, limit *int) *SparsityRowReader {
+	missing, suppressed := sparsity.Markers()
+
+	done := false
+	for _, dimension := range dimensions {
+		if len(dimension.Options) == 0 {
+			done = true
+		}
+	}
+
+	return &SparsityRowReader{
+		reader:     reader,
+		dimensions: dimensions,
+		missing:    missing,
+		suppressed: suppressed,
+		limit:      limit,
+		position:   make([]int, len(dimensions)),
+		done:       done,
+	}
+}
+
+// forFilter sets the filter the grid is being filled in for.
+func (reader *SparsityRowReader) forFilter(filter *Filter) *SparsityRowReader {
+	reader.filter = filter
+	return reader
+}
+
+// Read the next row of the grid, or return io.EOF. The first row is the header of the instance. The reader
+// is closed once io.EOF or an error is returned. An *Error matching ErrNoResultsFound is returned after the
+// header if the grid has no rows.
+func (reader *SparsityRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	if reader.closed {
+		return "", ErrReaderClosed
+	}
+
+	var row string
+	var err error
+	if !reader.started {
+		reader.started = true
+		row, err = reader.readHeader()
+	} else {
+		row, err = reader.read()
+	}
+
+	if err != nil {
+		reader.err = err
+		reader.Close()
+		return "", err
+	}
+
+	return row, nil
+}
+
+// readHeader reads the header of the instance, finding the columns of the grid dimensions, and the first
+// underlying row.
+func (reader *SparsityRowReader) readHeader() (string, error) {
+	row, err := reader.reader.Read()
+	if err != nil {
+		return "", err
+	}
+
+	header, err := ParseHeader(row)
+	if err != nil {
+		return "", err
+	}
+
+	reader.width = len(header.Columns)
+	for _, dimension := range reader.dimensions {
+		headerDimension := header.Dimension(dimension.Name)
+		if headerDimension == nil {
+			return "", ErrUnknownDimension
+		}
+		reader.codeColumns = append(reader.codeColumns, headerDimension.CodeListColumn)
+		reader.labelColumns = append(reader.labelColumns, headerDimension.LabelColumn)
+	}
+
+	if err := reader.next(); err != nil {
+		return "", err
+	}
+
+	if reader.done && reader.fields == nil {
+		reader.err = newError(ErrNoResultsFound, reader.filter, nil)
+		reader.Close()
+	}
+
+	return row, nil
+}
+
+// next reads the next underlying row. Once all the rows have been read the fields are nil.
+func (reader *SparsityRowReader) next() error {
+	row, err := reader.reader.Read()
+	if err == io.EOF || errors.Is(err, ErrNoResultsFound) {
+		reader.fields = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fields, err := parseCSVRow(row)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) != reader.width {
+		return ErrInvalidHeader
+	}
+
+	reader.row, reader.fields = row, fields
+	return nil
+}
+
+// compare returns a negative number if the current underlying row is before the current combination of
+// options, zero if it has those options, and a positive number if it is after them or there are no more
+// underlying rows.
+func (reader *SparsityRowReader) compare() int {
+	if reader.fields == nil {
+		return 1
+	}
+
+	for i, dimension := range reader.dimensions {
+		c := strings.Compare(reader.fields[reader.codeColumns[i]], dimension.Options[reader.position[i]].Code)
+		if dimension.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// advance moves on to the next combination of options, varying the last dimension fastest.
+func (reader *SparsityRowReader) advance() {
+	for i := len(reader.position) - 1; i >= 0; i-- {
+		reader.position[i]++
+		if reader.position[i] < len(reader.dimensions[i].Options) {
+			return
+		}
+		reader.position[i] = 0
+	}
+
+	reader.done = true
+}
+
+func (reader *SparsityRowReader) read() (string, error) {
+	if reader.done || (reader.limit != nil && reader.count >= *reader.limit) {
+		return "", io.EOF
+	}
+
+	for {
+		c := reader.compare()
+
+		// underlying rows that are not in the grid, e.g. more than one observation for a combination, are
+		// skipped
+		if c < 0 {
+			if err := reader.next(); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		reader.count++
+
+		if c > 0 {
+			row, err := reader.missingRow()
+			reader.advance()
+			return row, err
+		}
+
+		row := reader.row
+		if reader.fields[0] == "" {
+			fields := append([]string{reader.suppressed}, reader.fields[1:]...)
+
+			var err error
+			if row, err = formatCSVRow(fields); err != nil {
+				return "", err
+			}
+		}
+
+		reader.advance()
+		if err := reader.next(); err != nil {
+			return "", err
+		}
+
+		return row, nil
+	}
+}
+
+// missingRow returns the row for the current combination of options, which has no observation.
+func (reader *SparsityRowReader) missingRow() (string, error) {
+	fields := make([]string, reader.width)
+	fields[0] = reader.missing
+
+	for i, dimension := range reader.dimensions {
+		option := dimension.Options[reader.position[i]]
+		fields[reader.codeColumns[i]] = option.Code
+		fields[reader.labelColumns[i]] = option.Label
+	}
+
+	return formatCSVRow(fields)
+}
+
+// Close the underlying reader. Closing the reader more than once has no further effect.
+func (reader *SparsityRowReader) Close() error {
+	if !reader.closed {
+		reader.closed = true
+		reader.closeErr = reader.reader.Close()
+	}
+
+	return reader.closeErr
+}
@@ -0,0 +1,296 @@
+package observation_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var sparsityGrid = []*observation.GridDimension{
+	{Name: "age", Options: []*observation.DimensionOption{{Code: "29", Label: "29"}, {Code: "30", Label: "30"}}},
+	{Name: "sex", Options: []*observation.DimensionOption{{Code: "female", Label: "Female"}, {Code: "male", Label: "Male"}}},
+}
+
+func TestSparsityRowReader_Read(t *testing.T) {
+
+	Convey("Given a row reader returning some of the observations of a grid, sorted on its dimensions", t, func() {
+
+		rows := []string{
+			"V4_1,data_marking,sex_codelist,sex,age_codelist,age\n",
+			"10,,female,Female,29,29\n",
+			",c,female,Female,30,30\n",
+			"12,,male,Male,30,30\n",
+		}
+
+		Convey("When the rows are read", func() {
+
+			underlying := newMockRowReader(rows...)
+			reader := observation.NewSparsityRowReader(underlying, sparsityGrid, observation.Sparsity{}, nil)
+			actual, err := readAllRows(reader)
+
+			Convey("Every combination of options is returned, marking the missing and suppressed observations", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_1,data_marking,sex_codelist,sex,age_codelist,age\n",
+					"10,,female,Female,29,29\n",
+					"..,,male,Male,29,29\n",
+					"x,c,female,Female,30,30\n",
+					"12,,male,Male,30,30\n",
+				})
+			})
+
+			Convey("The underlying reader is closed", func() {
+				So(len(underlying.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the rows are read with custom markers and a limit", func() {
+
+			limit := 2
+			sparsity := observation.Sparsity{MissingMarker: "NA", SuppressedMarker: "[c]"}
+			reader := observation.NewSparsityRowReader(newMockRowReader(rows...), sparsityGrid, sparsity, &limit)
+			actual, err := readAllRows(reader)
+
+			Convey("The markers are used and only the limited number of rows follow the header", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_1,data_marking,sex_codelist,sex,age_codelist,age\n",
+					"10,,female,Female,29,29\n",
+					"NA,,male,Male,29,29\n",
+				})
+			})
+		})
+	})
+
+	Convey("Given a grid sorted descending on a dimension and a row reader without observations", t, func() {
+
+		grid := []*observation.GridDimension{
+			{Name: "sex", Descending: true, Options: []*observation.DimensionOption{{Code: "male", Label: "Male"}, {Code: "female", Label: "Female"}}},
+		}
+		rows := []string{"V4_0,sex_codelist,sex\n"}
+		underlying := &observationtest.CSVRowReaderMock{
+			ReadFunc: func() (string, error) {
+				if len(rows) == 0 {
+					return "", observation.ErrNoResultsFound
+				}
+				row := rows[0]
+				rows = rows[1:]
+				return row, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		Convey("When the rows are read", func() {
+
+			actual, err := readAllRows(observation.NewSparsityRowReader(underlying, grid, observation.Sparsity{}, nil))
+
+			Convey("Each option is returned as missing, in the order of the grid", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_0,sex_codelist,sex\n",
+					"..,male,Male\n",
+					"..,female,Female\n",
+				})
+			})
+		})
+	})
+
+	Convey("Given a grid with a dimension without any options", t, func() {
+
+		grid := []*observation.GridDimension{{Name: "sex"}}
+		underlying := newMockRowReader("V4_0,sex_codelist,sex\n")
+
+		Convey("When the rows are read", func() {
+
+			reader := observation.NewSparsityRowReader(underlying, grid, observation.Sparsity{}, nil)
+			header, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(header, ShouldEqual, "V4_0,sex_codelist,sex\n")
+			_, err = reader.Read()
+
+			Convey("An *observation.Error matching ErrNoResultsFound is returned after the header and the underlying reader is closed", func() {
+				var filterErr *observation.Error
+				So(errors.As(err, &filterErr), ShouldBeTrue)
+				So(errors.Is(err, observation.ErrNoResultsFound), ShouldBeTrue)
+				So(len(underlying.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetCSVRowsSparsity(t *testing.T) {
+
+	Convey("Given a store with a mock DB connection returning some of the observations of a filter", t, func() {
+
+		rows := [][]interface{}{{"12,,30,30,male,Male"}, {"10,,29,29,female,Female"}}
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				if len(rows) == 0 {
+					return nil, nil, io.EOF
+				}
+				row := rows[0]
+				rows = rows[1:]
+				return row, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				switch {
+				case strings.Contains(query, "_888_age`"):
+					return [][]interface{}{{"31", "31", int64(0)}, {"30", "30", int64(0)}, {"29", "29", int64(0)}}, nil, nil, nil
+				case strings.Contains(query, "_888_sex`"):
+					return [][]interface{}{{"male", "Male", int64(0)}, {"female", "Female", int64(0)}}, nil, nil, nil
+				}
+				return [][]interface{}{{"V4_1,data_marking,age_codelist,age,sex_codelist,sex"}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return mockBoltRows, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		store := observation.NewStore(&observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		})
+
+		filter := &observation.Filter{
+			InstanceID:       "888",
+			DimensionFilters: []*observation.DimensionFilter{{Name: "age", Options: []string{"30", "29", "99"}}},
+			Sort:             []*observation.SortDimension{{Name: "sex", Descending: true}},
+			Sparsity:         &observation.Sparsity{},
+		}
+
+		Convey("When the rows are read", func() {
+
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+			So(err, ShouldBeNil)
+			actual, err := readAllRows(reader)
+
+			Convey("The observations are sorted on every dimension, starting with the sort of the filter", func() {
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 1)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEndWith, " ORDER BY `sex`.value DESC, `age`.value, o.value")
+			})
+
+			Convey("A row is returned for every selected option of the instance, marking the missing observations", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, []string{
+					"V4_1,data_marking,age_codelist,age,sex_codelist,sex\n",
+					"..,,29,29,male,Male\n",
+					"12,,30,30,male,Male\n",
+					"10,,29,29,female,Female\n",
+					"..,,30,30,female,Female\n",
+				})
+			})
+		})
+	})
+
+	Convey("Given a store and a complete grid of a filter selecting only options that do not exist", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				if strings.Contains(query, "_888_sex`") {
+					return [][]interface{}{{"male", "Male", int64(0)}}, nil, nil, nil
+				}
+				return [][]interface{}{{"V4_0,sex_codelist,sex"}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return &observationtest.BoltRowsMock{
+					NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+						return nil, nil, io.EOF
+					},
+					CloseFunc: func() error {
+						return nil
+					},
+				}, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		store := observation.NewStore(&observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		})
+
+		filter := &observation.Filter{
+			FilterID:         "filter-1",
+			InstanceID:       "888",
+			DimensionFilters: []*observation.DimensionFilter{{Name: "sex", Options: []string{"other"}}},
+			Sparsity:         &observation.Sparsity{},
+		}
+
+		Convey("When the rows are read", func() {
+
+			reader, err := store.GetCSVRows(testContext, filter, nil)
+			So(err, ShouldBeNil)
+			_, err = readAllRows(reader)
+
+			Convey("An *observation.Error for the filter matching ErrNoResultsFound is returned", func() {
+				var filterErr *observation.Error
+				So(errors.As(err, &filterErr), ShouldBeTrue)
+				So(errors.Is(err, observation.ErrNoResultsFound), ShouldBeTrue)
+				So(filterErr.InstanceID, ShouldEqual, "888")
+				So(filterErr.FilterID, ShouldEqual, "filter-1")
+			})
+		})
+	})
+
+	Convey("Given a filter with a complete grid and an aggregation", t, func() {
+
+		filter := &observation.Filter{
+			InstanceID:  "888",
+			Aggregation: &observation.Aggregation{Function: observation.AggregateSum},
+			Sparsity:    &observation.Sparsity{},
+		}
+
+		Convey("When the filter is validated", func() {
+
+			err := filter.Validate()
+
+			Convey("ErrInvalidSparsity is returned", func() {
+				So(err, ShouldEqual, observation.ErrInvalidSparsity)
+			})
+		})
+	})
+}
+
+func TestFilter_FingerprintSparsity(t *testing.T) {
+
+	Convey("Given a filter with a complete grid using the default markers", t, func() {
+
+		filter := observation.Filter{InstanceID: "888", Sparsity: &observation.Sparsity{}}
+
+		Convey("Its fingerprint differs from the sparse filter, but not from the grid setting the default markers", func() {
+			sparse := observation.Filter{InstanceID: "888"}
+			defaults := observation.Filter{
+				InstanceID: "888",
+				Sparsity: &observation.Sparsity{
+					MissingMarker:    observation.DefaultMissingMarker,
+					SuppressedMarker: observation.DefaultSuppressedMarker,
+				},
+			}
+
+			So(filter.Fingerprint(), ShouldNotEqual, sparse.Fingerprint())
+			So(filter.Fingerprint(), ShouldEqual, defaults.Fingerprint())
+		})
+	})
+}
@@ -5,94 +5,347 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/ONSdigital/log.go/log"
 	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
 )
 
 //go:generate moq -out observationtest/db_pool.go -pkg observationtest . DBPool
+//go:generate moq -out observationtest/csv_row_getter.go -pkg observationtest . CSVRowGetter
+//go:generate moq -out observationtest/logger.go -pkg observationtest . Logger
+
+// Check that the store conforms to the CSVRowGetter interface.
+var _ CSVRowGetter = (*Store)(nil)
 
 // Store represents storage for observation data.
 type Store struct {
-	pool DBPool
+	pool        DBPool
+	prefetch    int // the number of rows to read ahead of the reader, or zero to read rows on demand
+	limits      Limits
+	timeouts    Timeouts
+	connTimeout time.Duration // the timeout of the connections of the pool, restored after a query timeout
+	logger      Logger
+	logPolicy   LogPolicy
+	readPool    DBPool // the pool reads are routed to, if it differs from pool
+	readTx      bool   // whether to run each call in an explicit read transaction
+	healthCheck HealthCheck
 }
 
+// Option configures optional behaviour of a Store.
+type Option func(store *Store)
+
 // DBPool provides a pool of database connections
 type DBPool interface {
 	OpenPool() (bolt.Conn, error)
 }
 
-// NewStore returns a new store instace using the given DB connection.
-func NewStore(pool DBPool) *Store {
-	return &Store{
-		pool: pool,
+// CSVRowGetter provides the CSV rows for a filter. It is implemented by Store and by types wrapping it.
+type CSVRowGetter interface {
+	GetCSVRows(ctx context.Context, filter *Filter, limit *int) (CSVRowReader, error)
+}
+
+// NewStore returns a new store instace using the given DB connection and options. The store logs nothing
+// unless WithLogger is used, e.g. with onslog.New() to log through log.Event.
+func NewStore(pool DBPool, opts ...Option) *Store {
+	store := &Store{
+		pool:        pool,
+		connTimeout: defaultConnectionTimeout,
+		logger:      nopLogger{},
+		logPolicy:   DefaultLogPolicy(),
 	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	return store
 }
 
 // GetCSVRows returns a reader allowing individual CSV rows to be read. Rows returned
 // can be limited, to stop this pass in nil. If filter.DimensionFilters is nil, empty or contains only empty values then
-// a CSVRowReader for the entire dataset will be returned.
+// a CSVRowReader for the entire dataset will be returned. If filter.Projection is set then only the selected
+// dimension columns are returned. If filter.Sort is set then the rows are returned in a deterministic order.
+// If filter.Sparsity is set then a row is returned for every combination of the selected options, and the
+// rows are sorted on every dimension. The first row returned is always the instance header, which is not
+// included in the limit.
 func (store *Store) GetCSVRows(ctx context.Context, filter *Filter, limit *int) (CSVRowReader, error) {
+	start := time.Now()
 
-	headerRowQuery := fmt.Sprintf("MATCH (i:`_%s_Instance`) RETURN i.header as row", filter.InstanceID)
+	if err := store.validateFilter(filter); err != nil {
+		return nil, err
+	}
 
-	unionQuery := headerRowQuery + " UNION ALL " + createObservationQuery(ctx, filter)
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
 
-	if limit != nil {
-		limitAsString := strconv.Itoa(*limit)
-		unionQuery += " LIMIT " + limitAsString
+	// The header is read separately so that the limit only applies to the observations, and so that a
+	// missing instance is reported before any rows are read.
+	header, err := getHeader(conn, filter)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := CheckSortDimensions(filter, header); err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	log.Event(ctx, "neo4j query", log.INFO, log.Data{
-		"filterID":   filter.FilterID,
-		"instanceID": filter.InstanceID,
-		"query":      unionQuery,
-	})
-	conn, err := store.pool.OpenPool()
+	if err := store.limits.checkEstimatedRows(conn, filter, header); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var grid []*GridDimension
+	if filter.Sparsity != nil {
+		if filter, grid, err = prepareGrid(conn, filter, header); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	rowReader, err := store.queryObservations(ctx, conn, filter, header, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := conn.QueryNeo(unionQuery, nil)
+	rowReader = store.newTimeoutRowReader(ctx, rowReader, filter, start)
+
+	if filter.Sparsity != nil {
+		rowReader = NewSparsityRowReader(rowReader, grid, *filter.Sparsity, limit).forFilter(filter)
+	}
+
+	if store.prefetch > 0 {
+		rowReader = NewPrefetchRowReader(ctx, rowReader, store.prefetch)
+	}
+
+	if filter.Projection != nil {
+		rowReader = NewProjectionRowReader(rowReader, filter.Projection)
+	}
+
+	return rowReader, nil
+}
+
+// validateFilter checks the options of the filter that cannot be checked by the database, and checks the
+// options selected against the limits of the store.
+func (store *Store) validateFilter(filter *Filter) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	return store.limits.checkOptionLimits(filter)
+}
+
+// CheckSortDimensions checks that each sort dimension of the filter is a dimension of the instance with the
+// given header row, as sorting on a dimension that does not exist would match no observations.
+func CheckSortDimensions(filter *Filter, header string) error {
+	if len(filter.Sort) == 0 {
+		return nil
+	}
+
+	parsed, err := ParseHeader(header)
+	if err != nil {
+		return err
+	}
+
+	for _, dimension := range filter.Sort {
+		if parsed.Dimension(dimension.Name) == nil {
+			return ErrUnknownDimension
+		}
+	}
+
+	return nil
+}
+
+// queryObservations runs the observation query for the filter using the given connection, returning a row
+// reader that returns the given header followed by the observations. The connection is closed if the query
+// fails, otherwise the row reader is responsible for closing it.
+func (store *Store) queryObservations(ctx context.Context, conn bolt.Conn, filter *Filter, header string, limit *int) (CSVRowReader, error) {
+	if filter.IsEmpty() && len(filter.Sort) == 0 && filter.Aggregation == nil {
+		store.log(ctx, LevelInfo, "no dimension filters supplied, generating entire dataset query", map[string]interface{}{
+			"filterID":   filter.FilterID,
+			"instanceID": filter.InstanceID,
+		}, nil)
+	}
+
+	if filter.Aggregation != nil {
+		var err error
+		if header, err = filter.Aggregation.RewriteHeader(header); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	query := createQuery(filter, limit)
+	store.logQuery(ctx, filter, limit, query)
+
+	rows, err := conn.QueryNeo(query.Statement, query.Parameters)
 	if err != nil {
 		// Before returning the error "close" the open connection to release it back into the pool.
 		conn.Close()
-		return nil, err
+		return nil, newDriverError(filter, err)
 	}
+
 	// The connection can only be closed once the results have been read, so the row reader is responsible for
 	// releasing the connection back into the pool
-	return NewBoltRowReader(rows, conn), nil
+	return NewBoltRowReaderWithHeader(header, rows, conn).forFilter(filter), nil
 }
 
-func createObservationQuery(ctx context.Context, filter *Filter) string {
-	if filter.IsEmpty() {
+// GetHeader returns the header row of the given instance, without a trailing new line. If the instance does
+// not exist then an error matching ErrNoInstanceFound is returned.
+func (store *Store) GetHeader(ctx context.Context, instanceID string) (string, error) {
+	filter := &Filter{InstanceID: instanceID}
+
+	conn, err := store.openConn(ctx, filter)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return getHeader(conn, filter)
+}
+
+// getHeader queries the header row of the filtered instance using the given connection.
+func getHeader(conn bolt.Conn, filter *Filter) (string, error) {
+	query := NewHeaderQuery(filter.InstanceID)
+
+	data, _, _, err := conn.QueryNeoAll(query.Statement, query.Parameters)
+	if err != nil {
+		return "", newDriverError(filter, err)
+	}
+
+	if len(data) == 0 {
+		return "", newError(ErrNoInstanceFound, filter, nil)
+	}
+
+	if len(data[0]) == 0 || data[0][0] == nil || data[0][0] == "" {
+		return "", newError(ErrNoHeaderFound, filter, nil)
+	}
+
+	header, ok := data[0][0].(string)
+	if !ok {
+		return "", newError(ErrUnrecognisedType, filter, nil)
+	}
+
+	return header, nil
+}
+
+// NewHeaderQuery returns the query for the header row of the given instance.
+func NewHeaderQuery(instanceID string) *Query {
+	return &Query{
+		Statement: fmt.Sprintf("MATCH (i:`_%s_Instance`) RETURN i.header as row", instanceID),
+	}
+}
+
+// NewQuery returns the query for the observations of the filter, for backends running the queries built by
+// the store. The filter is expected to be valid.
+func NewQuery(filter *Filter, limit *int) *Query {
+	return createQuery(filter, limit)
+}
+
+// createQuery returns the query for the observations of the filter.
+func createQuery(filter *Filter, limit *int) *Query {
+	statement := createObservationQuery(filter)
+
+	if limit != nil {
+		limitAsString := strconv.Itoa(*limit)
+		statement += " LIMIT " + limitAsString
+	}
+
+	return &Query{
+		Statement: statement,
+	}
+}
+
+func createObservationQuery(filter *Filter) string {
+	if filter.Aggregation != nil {
+		return createAggregationQuery(filter)
+	}
+
+	if filter.IsEmpty() && len(filter.Sort) == 0 {
 		// if no dimension filter are specified than match all observations
-		log.Event(ctx, "no dimension filters supplied, generating entire dataset query", log.INFO, log.Data{
-			"filterID":   filter.FilterID,
-			"instanceID": filter.InstanceID,
-		})
 		return fmt.Sprintf("MATCH(o: `_%s_observation`) return o.value as row", filter.InstanceID)
 	}
 
-	matchDimensions := "MATCH "
-	where := " WHERE "
+	matches, where := createFilterClauses(filter)
+	matched := filteredDimensions(filter)
+
+	// dimensions that are only used for sorting still need to be matched so their values can be ordered on
+	for _, sort := range filter.Sort {
+		name := strings.ToLower(sort.Name)
+		if !matched[name] {
+			matches = append(matches, createDimensionMatch(filter.InstanceID, name))
+			matched[name] = true
+		}
+	}
+
+	query := createMatchQuery(matches, where) + " RETURN o.value AS row"
 
-	count := 0
+	if len(filter.Sort) > 0 {
+		query += createOrderBy(filter.Sort)
+	}
+
+	return query
+}
+
+// createFilterClauses returns the patterns matching the dimensions of the filter, and the conditions
+// restricting them to the selected options.
+func createFilterClauses(filter *Filter) (matches, where []string) {
 	for _, dimension := range filter.DimensionFilters {
 		// If the dimension options is empty then don't bother specifying in the query as this will exclude all matches.
-		if len(dimension.Options) > 0 {
-			if count > 0 {
-				matchDimensions += ", "
-				where += " AND "
-			}
-
-			matchDimensions += fmt.Sprintf("(o)-[:isValueOf]->(`%s`:`_%s_%s`)", dimension.Name, filter.InstanceID, dimension.Name)
-			where += createOptionList(dimension.Name, dimension.Options)
-			count++
+		if dimension.Name != "" && len(dimension.Options) > 0 {
+			matches = append(matches, createDimensionMatch(filter.InstanceID, dimension.Name))
+			where = append(where, createOptionList(dimension.Name, dimension.Options))
+		}
+	}
+
+	return matches, where
+}
+
+// filteredDimensions returns the names of the dimensions matched by createFilterClauses.
+func filteredDimensions(filter *Filter) map[string]bool {
+	names := make(map[string]bool)
+	for _, dimension := range filter.DimensionFilters {
+		if dimension.Name != "" && len(dimension.Options) > 0 {
+			names[dimension.Name] = true
 		}
 	}
 
-	return matchDimensions + where + " RETURN o.value AS row"
+	return names
+}
+
+func createMatchQuery(matches, where []string) string {
+	query := "MATCH " + strings.Join(matches, ", ")
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	return query
+}
+
+func createDimensionMatch(instanceID, name string) string {
+	return fmt.Sprintf("(o)-[:isValueOf]->(`%s`:`_%s_%s`)", name, instanceID, name)
+}
+
+// createOrderBy returns an ORDER BY clause for the given sort dimensions. The observation value is always
+// used as the final sort key so that the order of the rows is deterministic.
+func createOrderBy(sort []*SortDimension) string {
+	var keys []string
+
+	for _, dimension := range sort {
+		// graph labels are lower case, and sort dimensions are checked against the header ignoring case
+		key := fmt.Sprintf("`%s`.value", strings.ToLower(dimension.Name))
+		if dimension.Descending {
+			key += " DESC"
+		}
+		keys = append(keys, key)
+	}
+
+	keys = append(keys, "o.value")
+
+	return " ORDER BY " + strings.Join(keys, ", ")
 }
 
 func createOptionList(name string, opts []string) string {
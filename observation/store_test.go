@@ -2,6 +2,7 @@ package observation_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -13,6 +14,8 @@ import (
 
 var testContext = context.Background()
 
+const expectedHeader = "V4_0,age_codelist,age,sex_codelist,sex"
+
 func TestStore_GetCSVRows(t *testing.T) {
 
 	Convey("Given an store with a mock DB connection", t, func() {
@@ -25,9 +28,7 @@ func TestStore_GetCSVRows(t *testing.T) {
 			},
 		}
 
-		expectedQuery := "MATCH (i:`_888_Instance`) RETURN i.header as row " +
-			"UNION ALL " +
-			"MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) " +
+		expectedQuery := "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) " +
 			"WHERE (`age`.value='29' OR `age`.value='30') " +
 			"AND (`sex`.value='male' OR `sex`.value='female') " +
 			"RETURN o.value AS row"
@@ -44,9 +45,15 @@ func TestStore_GetCSVRows(t *testing.T) {
 		}
 
 		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
 			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
 				return mockBoltRows, nil
 			},
+			CloseFunc: func() error {
+				return nil
+			},
 		}
 
 		mockedPool := &observationtest.DBPoolMock{
@@ -75,6 +82,18 @@ func TestStore_GetCSVRows(t *testing.T) {
 			})
 		})
 
+		Convey("When GetCSVRows is called with a projection that both includes and excludes dimensions", func() {
+
+			filter.Projection = &observation.Projection{Include: []string{"age"}, Exclude: []string{"sex"}}
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The expected error is returned without querying the database", func() {
+				So(err, ShouldEqual, observation.ErrInvalidProjection)
+				So(rowReader, ShouldBeNil)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+			})
+		})
+
 		Convey("When GetCSVRows is called with a limit of 20", func() {
 
 			limitRows := 20
@@ -96,16 +115,130 @@ func TestStore_GetCSVRows(t *testing.T) {
 	})
 }
 
+func TestStore_GetCSVRowsNoInstance(t *testing.T) {
+
+	Convey("Given an store with a mock DB connection that finds no instance", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{}, nil, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetCSVRows is called", func() {
+
+			filter := &observation.Filter{InstanceID: "888"}
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("The instance is not found, no observations are queried and the connection is released", func() {
+				So(rowReader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrNoInstanceFound), ShouldBeTrue)
+				So(mockedDBConnection.QueryNeoAllCalls()[0].Query, ShouldEqual, "MATCH (i:`_888_Instance`) RETURN i.header as row")
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetHeader is called", func() {
+
+			header, err := store.GetHeader(testContext, "888")
+
+			Convey("The instance is not found and the connection is released", func() {
+				So(header, ShouldEqual, "")
+				So(errors.Is(err, observation.ErrNoInstanceFound), ShouldBeTrue)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetHeader(t *testing.T) {
+
+	Convey("Given an store with a mock DB connection", t, func() {
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetHeader is called", func() {
+
+			header, err := store.GetHeader(testContext, "888")
+
+			Convey("The header of the instance is returned and the connection is released", func() {
+				So(err, ShouldBeNil)
+				So(header, ShouldEqual, expectedHeader)
+				So(mockedDBConnection.QueryNeoAllCalls()[0].Query, ShouldEqual, "MATCH (i:`_888_Instance`) RETURN i.header as row")
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestStore_GetCSVRowsPoolError(t *testing.T) {
+
+	Convey("Given an store with a mock DB pool that fails to open a connection", t, func() {
+
+		poolErr := errors.New("no connections available")
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return nil, poolErr
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetCSVRows is called", func() {
+
+			filter := &observation.Filter{FilterID: "123", InstanceID: "888"}
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("A driver error for the filter is returned", func() {
+				So(rowReader, ShouldBeNil)
+				So(errors.Is(err, observation.ErrDriver), ShouldBeTrue)
+				So(errors.Is(err, poolErr), ShouldBeTrue)
+
+				var observationErr *observation.Error
+				So(errors.As(err, &observationErr), ShouldBeTrue)
+				So(observationErr.InstanceID, ShouldEqual, "888")
+				So(observationErr.FilterID, ShouldEqual, "123")
+			})
+		})
+	})
+}
+
 func TestStore_GetCSVRowsEmptyFilter(t *testing.T) {
 	filterID := "1234567890"
 	InstanceID := "0987654321"
 
-	expectedQuery := fmt.Sprintf("MATCH (i:`_%s_Instance`) RETURN i.header as row UNION ALL "+
-		"MATCH(o: `_%s_observation`) return o.value as row", InstanceID, InstanceID)
+	expectedQuery := fmt.Sprintf("MATCH(o: `_%s_observation`) return o.value as row", InstanceID)
 
 	Convey("Given valid database connection", t, func() {
 
-		expectedCSVRowHeader := "the,csv,row"
 		expectedCSVRowData := "1,2,3"
 
 		mockBoltRows := &observationtest.BoltRowsMock{
@@ -113,14 +246,20 @@ func TestStore_GetCSVRowsEmptyFilter(t *testing.T) {
 				return nil
 			},
 			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
-				return []interface{}{expectedCSVRowHeader, expectedCSVRowData}, nil, nil
+				return []interface{}{expectedCSVRowData}, nil, nil
 			},
 		}
 
 		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
 			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
 				return mockBoltRows, nil
 			},
+			CloseFunc: func() error {
+				return nil
+			},
 		}
 
 		mockedPool := &observationtest.DBPoolMock{
@@ -139,7 +278,7 @@ func TestStore_GetCSVRowsEmptyFilter(t *testing.T) {
 			}
 
 			result, err := store.GetCSVRows(testContext, filter, nil)
-			assertEmptyFilterResults(result, expectedCSVRowHeader, err)
+			assertEmptyFilterResults(result, expectedHeader, err)
 			assertEmptyFilterQueryInvocations(mockedDBConnection, expectedQuery)
 		})
 
@@ -151,7 +290,7 @@ func TestStore_GetCSVRowsEmptyFilter(t *testing.T) {
 			}
 
 			result, err := store.GetCSVRows(testContext, filter, nil)
-			assertEmptyFilterResults(result, expectedCSVRowHeader, err)
+			assertEmptyFilterResults(result, expectedHeader, err)
 			assertEmptyFilterQueryInvocations(mockedDBConnection, expectedQuery)
 		})
 
@@ -168,7 +307,7 @@ func TestStore_GetCSVRowsEmptyFilter(t *testing.T) {
 			}
 
 			result, err := store.GetCSVRows(testContext, filter, nil)
-			assertEmptyFilterResults(result, expectedCSVRowHeader, err)
+			assertEmptyFilterResults(result, expectedHeader, err)
 			assertEmptyFilterQueryInvocations(mockedDBConnection, expectedQuery)
 		})
 	})
@@ -198,9 +337,15 @@ func TestStore_GetCSVRowsDimensionEmpty(t *testing.T) {
 		}
 
 		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
 			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
 				return mockBoltRows, nil
 			},
+			CloseFunc: func() error {
+				return nil
+			},
 		}
 
 		mockedPool := &observationtest.DBPoolMock{
@@ -213,9 +358,7 @@ func TestStore_GetCSVRowsDimensionEmpty(t *testing.T) {
 
 		Convey("When GetCSVRows is called with a filter with an empty dimension options and no limit", func() {
 
-			expectedQuery := "MATCH (i:`_888_Instance`) RETURN i.header as row " +
-				"UNION ALL " +
-				"MATCH (o)-[:isValueOf]->(`age`:`_888_age`) " +
+			expectedQuery := "MATCH (o)-[:isValueOf]->(`age`:`_888_age`) " +
 				"WHERE (`age`.value='29' OR `age`.value='30') " +
 				"RETURN o.value AS row"
 
@@ -237,6 +380,125 @@ func TestStore_GetCSVRowsDimensionEmpty(t *testing.T) {
 	})
 }
 
+func TestStore_GetCSVRowsSorted(t *testing.T) {
+
+	Convey("Given an store with a mock DB connection", t, func() {
+
+		mockBoltRows := &observationtest.BoltRowsMock{
+			CloseFunc: func() error {
+				return nil
+			},
+			NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+				return []interface{}{"the,csv,row"}, nil, nil
+			},
+		}
+
+		mockedDBConnection := &observationtest.ConnMock{
+			QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return [][]interface{}{{expectedHeader}}, nil, nil, nil
+			},
+			QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+				return mockBoltRows, nil
+			},
+			CloseFunc: func() error {
+				return nil
+			},
+		}
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool)
+
+		Convey("When GetCSVRows is called with a filter sorted by a filtered and an unfiltered dimension", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				DimensionFilters: []*observation.DimensionFilter{
+					{Name: "age", Options: []string{"29", "30"}},
+				},
+				Sort: []*observation.SortDimension{
+					{Name: "sex", Descending: true},
+					{Name: "age"},
+				},
+			}
+
+			limitRows := 20
+			rowReader, err := store.GetCSVRows(testContext, filter, &limitRows)
+
+			Convey("Then the query orders the rows by the sort dimensions and the observation", func() {
+
+				expectedQuery := "MATCH (o)-[:isValueOf]->(`age`:`_888_age`), (o)-[:isValueOf]->(`sex`:`_888_sex`) " +
+					"WHERE (`age`.value='29' OR `age`.value='30') " +
+					"RETURN o.value AS row " +
+					"ORDER BY `sex`.value DESC, `age`.value, o.value " +
+					"LIMIT 20"
+
+				So(err, ShouldBeNil)
+				So(rowReader, ShouldNotBeNil)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 1)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEqual, expectedQuery)
+			})
+		})
+
+		Convey("When GetCSVRows is called with an empty filter sorted by a dimension named in a different case", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				Sort:       []*observation.SortDimension{{Name: "Sex"}},
+			}
+
+			_, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("Then the query matches the lower case sort dimension for all observations", func() {
+
+				expectedQuery := "MATCH (o)-[:isValueOf]->(`sex`:`_888_sex`) " +
+					"RETURN o.value AS row " +
+					"ORDER BY `sex`.value, o.value"
+
+				So(err, ShouldBeNil)
+				So(mockedDBConnection.QueryNeoCalls()[0].Query, ShouldEqual, expectedQuery)
+			})
+		})
+
+		Convey("When GetCSVRows is called with a dimension sorted more than once", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				Sort:       []*observation.SortDimension{{Name: "sex"}, {Name: "Sex", Descending: true}},
+			}
+
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("Then the expected error is returned without querying the database", func() {
+				So(err, ShouldEqual, observation.ErrInvalidSort)
+				So(rowReader, ShouldBeNil)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When GetCSVRows is called with a filter sorted by a dimension that is not in the instance", func() {
+
+			filter := &observation.Filter{
+				InstanceID: "888",
+				Sort:       []*observation.SortDimension{{Name: "time"}},
+			}
+
+			rowReader, err := store.GetCSVRows(testContext, filter, nil)
+
+			Convey("Then ErrUnknownDimension is returned without querying the observations", func() {
+				So(err, ShouldEqual, observation.ErrUnknownDimension)
+				So(rowReader, ShouldBeNil)
+				So(len(mockedDBConnection.QueryNeoCalls()), ShouldEqual, 0)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
 func assertEmptyFilterResults(reader observation.CSVRowReader, expectedCSVRow string, err error) {
 	Convey("The expected result is returned with no error", func() {
 		So(err, ShouldBeNil)
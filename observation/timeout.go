@@ -0,0 +1,250 @@
+package observation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	bolterrors "github.com/johnnadratowski/golang-neo4j-bolt-driver/errors"
+)
+
+// ErrTimeout is returned if a database call does not complete within its timeout.
+var ErrTimeout = errors.New("the database call timed out")
+
+// defaultConnectionTimeout is the read and write timeout of a connection opened by the bolt driver unless
+// its URL sets one, which is restored before a connection with a query timeout is released back into the
+// pool unless WithConnectionTimeout is used.
+const defaultConnectionTimeout = 60 * time.Second
+
+// Timeouts bounds how long each stage of a store call may take. A timeout of zero or less is unlimited.
+// A deadline on the context of a call also applies to each stage.
+type Timeouts struct {
+	Acquire time.Duration // to open a connection from the pool
+	Query   time.Duration // for each response from the database, including the start of the results
+	Stream  time.Duration // from the call to the last row being read
+}
+
+type timeoutsKey struct{}
+
+// WithTimeouts returns an option setting the default timeouts of each store call.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(store *Store) {
+		store.timeouts = timeouts
+	}
+}
+
+// WithConnectionTimeout returns an option setting the read and write timeout restored on a connection
+// after a query timeout, which should match the timeout of the bolt URL of the pool, e.g. ?timeout=120.
+func WithConnectionTimeout(timeout time.Duration) Option {
+	return func(store *Store) {
+		store.connTimeout = timeout
+	}
+}
+
+// ContextWithTimeouts returns a context that overrides the default timeouts of the store for the calls it
+// is used for.
+func ContextWithTimeouts(ctx context.Context, timeouts Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, timeouts)
+}
+
+// timeoutsFor returns the timeouts of a call using the given context.
+func (store *Store) timeoutsFor(ctx context.Context) Timeouts {
+	if timeouts, ok := ctx.Value(timeoutsKey{}).(Timeouts); ok {
+		return timeouts
+	}
+
+	return store.timeouts
+}
+
+// openConn opens a connection from the read pool, within the acquire timeout, sets the query timeout on it
+// and begins a read transaction on it if required. A connection leased from a tracked pool that leaks is
+// closed through these wrappers, so that its transaction is rolled back and its timeout restored.
+func (store *Store) openConn(ctx context.Context, filter *Filter) (bolt.Conn, error) {
+	timeouts := store.timeoutsFor(ctx)
+
+	leased, err := store.acquire(ctx, timeouts.Acquire)
+	if err != nil {
+		return nil, store.acquireError(ctx, filter, timeouts.Acquire, err)
+	}
+
+	conn := leased
+
+	query := timeouts.Query
+	if deadline, ok := ctx.Deadline(); ok && (query <= 0 || time.Until(deadline) < query) {
+		query = time.Until(deadline)
+	}
+
+	if query > 0 {
+		conn.SetTimeout(query)
+		conn = &timeoutConn{Conn: conn, timeout: store.connTimeout}
+	}
+
+	if conn, err = store.beginRead(ctx, conn, filter); err != nil {
+		return nil, err
+	}
+
+	closeLeaked(leased, conn)
+	return conn, nil
+}
+
+// errAcquireTimeout is returned by acquire if the acquire timeout is reached.
+var errAcquireTimeout = errors.New("acquire timeout reached")
+
+// acquire opens a connection from the pool, giving up once the timeout or the context deadline is reached.
+func (store *Store) acquire(ctx context.Context, timeout time.Duration) (bolt.Conn, error) {
+	if timeout <= 0 && ctx.Done() == nil {
+		return store.openRead()
+	}
+
+	type result struct {
+		conn bolt.Conn
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		conn, err := store.openRead()
+		results <- result{conn: conn, err: err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	select {
+	case r := <-results:
+		return r.conn, r.err
+	case <-expired:
+		err = errAcquireTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// release the connection back into the pool if it is opened after giving up on it
+	go func() {
+		if r := <-results; r.err == nil {
+			r.conn.Close()
+		}
+	}()
+
+	return nil, err
+}
+
+// acquireError returns the error for a failure to acquire a connection.
+func (store *Store) acquireError(ctx context.Context, filter *Filter, timeout time.Duration, err error) error {
+	switch err {
+	case errAcquireTimeout:
+		return newError(ErrTimeout, filter, fmt.Errorf("no connection was acquired within %s", timeout))
+	case context.DeadlineExceeded:
+		return newError(ErrTimeout, filter, err)
+	case context.Canceled:
+		return err
+	}
+
+	return newDriverError(filter, err)
+}
+
+// newDriverError returns the error for a failure of the database driver, which is a timeout error if the
+// driver failed because its connection timed out.
+func newDriverError(filter *Filter, err error) *Error {
+	if isTimeout(err) {
+		return newError(ErrTimeout, filter, err)
+	}
+
+	return newError(ErrDriver, filter, err)
+}
+
+// isTimeout returns true if the error is, or was caused by, a network timeout.
+func isTimeout(err error) bool {
+	if boltErr, ok := err.(*bolterrors.Error); ok {
+		err = boltErr.InnerMost()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// timeoutConn restores the timeout of a connection before releasing it back into the pool, so that the
+// query timeout of one call does not apply to the next user of the connection.
+type timeoutConn struct {
+	bolt.Conn
+	timeout time.Duration // the timeout of the connection before the query timeout was set
+}
+
+func (conn *timeoutConn) Close() error {
+	conn.Conn.SetTimeout(conn.timeout)
+	return conn.Conn.Close()
+}
+
+// timeoutRowReader returns a timeout error, and closes the underlying reader to release its connection,
+// if a row is read after the stream deadline or after the context is done.
+type timeoutRowReader struct {
+	ctx      context.Context
+	reader   CSVRowReader
+	deadline time.Time // the zero time if there is no stream timeout
+	filter   *Filter
+	err      error // the timeout error, once reached
+	closed   bool
+	closeErr error
+}
+
+// newTimeoutRowReader wraps the reader with the stream timeout of the call, if it has one.
+func (store *Store) newTimeoutRowReader(ctx context.Context, reader CSVRowReader, filter *Filter, start time.Time) CSVRowReader {
+	var deadline time.Time
+	if stream := store.timeoutsFor(ctx).Stream; stream > 0 {
+		deadline = start.Add(stream)
+	}
+
+	if ctx.Done() == nil && deadline.IsZero() {
+		return reader
+	}
+
+	return &timeoutRowReader{
+		ctx:      ctx,
+		reader:   reader,
+		deadline: deadline,
+		filter:   filter,
+	}
+}
+
+// Read the next row if the deadline has not been reached, or return io.EOF
+func (reader *timeoutRowReader) Read() (string, error) {
+	if reader.err != nil {
+		return "", reader.err
+	}
+
+	if err := reader.ctx.Err(); err == context.Canceled {
+		reader.err = err
+	} else if err != nil {
+		reader.err = newError(ErrTimeout, reader.filter, err)
+	} else if !reader.deadline.IsZero() && time.Now().After(reader.deadline) {
+		reader.err = newError(ErrTimeout, reader.filter, errors.New("the stream timeout was reached"))
+	}
+
+	if reader.err != nil {
+		reader.closeReader()
+		return "", reader.err
+	}
+
+	return reader.reader.Read()
+}
+
+// Close the underlying reader, unless it has already been closed after a timeout.
+func (reader *timeoutRowReader) Close() error {
+	reader.closeReader()
+	return reader.closeErr
+}
+
+func (reader *timeoutRowReader) closeReader() {
+	if !reader.closed {
+		reader.closed = true
+		reader.closeErr = reader.reader.Close()
+	}
+}
@@ -0,0 +1,185 @@
+package observation_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-filter/observation"
+	"github.com/ONSdigital/dp-filter/observation/observationtest"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// netTimeoutError is a net.Error that reports a timeout.
+type netTimeoutError struct{}
+
+func (netTimeoutError) Error() string   { return "i/o timeout" }
+func (netTimeoutError) Timeout() bool   { return true }
+func (netTimeoutError) Temporary() bool { return true }
+
+func newTimeoutConnection() *observationtest.ConnMock {
+	return &observationtest.ConnMock{
+		QueryNeoAllFunc: func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+			return [][]interface{}{{expectedHeader}}, nil, nil, nil
+		},
+		QueryNeoFunc: func(query string, params map[string]interface{}) (bolt.Rows, error) {
+			return &observationtest.BoltRowsMock{
+				NextNeoFunc: func() ([]interface{}, map[string]interface{}, error) {
+					return []interface{}{"1,29,29,male,Male"}, nil, nil
+				},
+				CloseFunc: func() error {
+					return nil
+				},
+			}, nil
+		},
+		SetTimeoutFunc: func(in1 time.Duration) {},
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+func TestStore_Timeouts(t *testing.T) {
+
+	Convey("Given a store with an acquire timeout and a mock DB pool that is slow to open a connection", t, func() {
+
+		mockedDBConnection := newTimeoutConnection()
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				time.Sleep(50 * time.Millisecond)
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool, observation.WithTimeouts(observation.Timeouts{Acquire: 5 * time.Millisecond}))
+
+		Convey("When GetHeader is called", func() {
+
+			header, err := store.GetHeader(testContext, "888")
+
+			Convey("A timeout error is returned and the connection is released once it has been opened", func() {
+				So(header, ShouldEqual, "")
+				So(errors.Is(err, observation.ErrTimeout), ShouldBeTrue)
+				So(errors.Is(err, observation.ErrDriver), ShouldBeFalse)
+
+				time.Sleep(100 * time.Millisecond)
+				So(len(mockedDBConnection.QueryNeoAllCalls()), ShouldEqual, 0)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetHeader is called with a context overriding the timeouts", func() {
+
+			ctx := observation.ContextWithTimeouts(testContext, observation.Timeouts{})
+			header, err := store.GetHeader(ctx, "888")
+
+			Convey("The connection is waited for and the header returned", func() {
+				So(err, ShouldBeNil)
+				So(header, ShouldEqual, expectedHeader)
+			})
+		})
+	})
+
+	Convey("Given a store with a query timeout and a mock DB connection", t, func() {
+
+		mockedDBConnection := newTimeoutConnection()
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool, observation.WithTimeouts(observation.Timeouts{Query: 2 * time.Second}))
+
+		Convey("When GetHeader is called", func() {
+
+			_, err := store.GetHeader(testContext, "888")
+
+			Convey("The query timeout is set on the connection and the default restored before it is released", func() {
+				So(err, ShouldBeNil)
+				So(len(mockedDBConnection.SetTimeoutCalls()), ShouldEqual, 2)
+				So(mockedDBConnection.SetTimeoutCalls()[0].In1, ShouldEqual, 2*time.Second)
+				So(mockedDBConnection.SetTimeoutCalls()[1].In1, ShouldEqual, 60*time.Second)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When GetHeader is called on a store with the timeout of the connections of its pool", func() {
+
+			store := observation.NewStore(mockedPool,
+				observation.WithTimeouts(observation.Timeouts{Query: 2 * time.Second}),
+				observation.WithConnectionTimeout(2*time.Minute))
+			_, err := store.GetHeader(testContext, "888")
+
+			Convey("The timeout of the connections is restored before it is released", func() {
+				So(err, ShouldBeNil)
+				So(len(mockedDBConnection.SetTimeoutCalls()), ShouldEqual, 2)
+				So(mockedDBConnection.SetTimeoutCalls()[1].In1, ShouldEqual, 2*time.Minute)
+			})
+		})
+
+		Convey("When the connection times out during a query", func() {
+
+			mockedDBConnection.QueryNeoAllFunc = func(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+				return nil, nil, nil, netTimeoutError{}
+			}
+
+			_, err := store.GetHeader(testContext, "888")
+
+			Convey("A timeout error is returned rather than a driver error", func() {
+				So(errors.Is(err, observation.ErrTimeout), ShouldBeTrue)
+				So(errors.Is(err, observation.ErrDriver), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a store with a stream timeout and a mock DB connection", t, func() {
+
+		mockedDBConnection := newTimeoutConnection()
+
+		mockedPool := &observationtest.DBPoolMock{
+			OpenPoolFunc: func() (bolt.Conn, error) {
+				return mockedDBConnection, nil
+			},
+		}
+
+		store := observation.NewStore(mockedPool, observation.WithTimeouts(observation.Timeouts{Stream: 20 * time.Millisecond}))
+
+		Convey("When rows are read after the stream timeout", func() {
+
+			reader, err := store.GetCSVRows(testContext, &observation.Filter{InstanceID: "888"}, nil)
+			So(err, ShouldBeNil)
+
+			_, err1 := reader.Read()
+			time.Sleep(30 * time.Millisecond)
+			_, err2 := reader.Read()
+			closeErr := reader.Close()
+
+			Convey("A timeout error is returned and the connection is released once", func() {
+				So(err1, ShouldBeNil)
+				So(errors.Is(err2, observation.ErrTimeout), ShouldBeTrue)
+				So(closeErr, ShouldBeNil)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When rows are read after the context is cancelled", func() {
+
+			ctx, cancel := context.WithTimeout(testContext, time.Hour)
+			reader, err := store.GetCSVRows(ctx, &observation.Filter{InstanceID: "888"}, nil)
+			So(err, ShouldBeNil)
+
+			cancel()
+			_, readErr := reader.Read()
+
+			Convey("The cancellation is returned", func() {
+				So(readErr, ShouldEqual, context.Canceled)
+				So(len(mockedDBConnection.CloseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}